@@ -16,9 +16,18 @@ import (
 	"time"
 
 	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
 	"github.com/gorilla/websocket"
 )
 
+// keepalive pings the server so that a dead connection fails the read, the
+// pings of the server are answered while reading
+var keepalive = common.Keepalive{
+	PingInterval: time.Second * 30,
+	PongWait:     time.Second * 60,
+	WriteWait:    time.Second * 10,
+}
+
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
@@ -26,7 +35,9 @@ func main() {
 
 	host := os.Getenv("SERVICE_HOST")
 	port := os.Getenv("SERVICE_PORT")
+	room := os.Getenv("ROOM")
 	name := os.Getenv("BOT_NAME")
+	apiKey := os.Getenv("API_KEY")
 
 	if host == "" {
 		host = "chat-server"
@@ -40,13 +51,18 @@ func main() {
 		name = fmt.Sprintf("bot_%d", randomInt)
 	}
 
+	if room == "" {
+		room = "common_room"
+	}
+
 	authUrl := fmt.Sprintf("http://%s:%s/auth", host, port)
-	pushUrl := fmt.Sprintf("ws://%s:%s/push?client_id=%s", host, port, name)
+	pushUrl := fmt.Sprintf("ws://%s:%s/push?room=%s&format=json", host, port, room)
 
 	// Authenticate with the server``
 	client := http.Client{}
 	postBody, _ := json.Marshal(map[string]string{
 		"client_id": name,
+		"secret":    apiKey,
 	})
 	responseBody := bytes.NewBuffer(postBody)
 	resp, err := client.Post(authUrl, "application/json", responseBody)
@@ -66,8 +82,8 @@ func main() {
 		)
 		return
 	}
-	authMsg := model.ResponseMessage{}
-	err = json.Unmarshal(b, &authMsg)
+	authResp := model.AuthResponse{}
+	err = json.Unmarshal(b, &authResp)
 	if err != nil {
 		logger.Error(
 			"json unmarshal",
@@ -78,21 +94,44 @@ func main() {
 
 	// websocket connection
 	headers := map[string][]string{
-		"Signature": {authMsg.Message},
+		"Authorization": {"Bearer " + authResp.Token},
 	}
 	conn, _, err := websocket.DefaultDialer.Dial(pushUrl, headers)
 	if err != nil {
 		log.Fatal("ws dial:", err)
 	}
 	defer conn.Close()
+	heartbeat := keepalive.Start(conn)
+	defer heartbeat.Stop()
+
+	// the server answers every message with an ack or an error frame carrying its ID
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			_, b, err := conn.ReadMessage()
+			if err != nil {
+				logger.Error(
+					"conn read message",
+					"error", err,
+				)
+				return
+			}
+			handleReply(logger, b)
+		}
+	}()
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	seq := 0
 Loop:
 	for {
 		select {
+		case <-closed:
+			break Loop
 		case <-sig:
+			conn.SetWriteDeadline(keepalive.WriteDeadline())
 			if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "woops")); err != nil {
 				logger.Error(
 					"sending close conn message failed",
@@ -101,8 +140,14 @@ Loop:
 			}
 			break Loop
 		default:
-			newMessage := genMessage()
-			if err := conn.WriteMessage(websocket.TextMessage, []byte(newMessage)); err != nil {
+			seq++
+			newMessage := model.PushRequest{
+				ID:      fmt.Sprintf("%s-%d-%d", name, time.Now().Unix(), seq),
+				Message: genMessage(),
+				SentAt:  time.Now().UnixMilli(),
+			}
+			conn.SetWriteDeadline(keepalive.WriteDeadline())
+			if err := conn.WriteJSON(newMessage); err != nil {
 				logger.Error(
 					"conn write message",
 					"error", err,
@@ -110,8 +155,9 @@ Loop:
 				return
 			}
 			logger.Info(
-				"message sent successfully",
+				"message sent",
 				"client_id", name,
+				"message_id", newMessage.ID,
 			)
 			<-time.After(time.Second * 4)
 		}
@@ -122,6 +168,52 @@ Loop:
 	)
 }
 
+// handleReply logs the ack or error frame the server sent for a message
+func handleReply(logger *slog.Logger, b []byte) {
+	frame := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(b, &frame); err != nil {
+		logger.Error(
+			"json unmarshal frame",
+			"error", err,
+		)
+		return
+	}
+
+	switch frame.Type {
+	case model.FrameTypeAck:
+		ack := model.AckFrame{}
+		if err := json.Unmarshal(b, &ack); err != nil {
+			logger.Error(
+				"json unmarshal ack frame",
+				"error", err,
+			)
+			return
+		}
+		logger.Info(
+			"message stored",
+			"message_id", ack.ID,
+			"cursor", ack.Cursor,
+		)
+	case model.FrameTypeError:
+		errFrame := model.ErrorFrame{}
+		if err := json.Unmarshal(b, &errFrame); err != nil {
+			logger.Error(
+				"json unmarshal error frame",
+				"error", err,
+			)
+			return
+		}
+		logger.Warn(
+			"message rejected",
+			"message_id", errFrame.ID,
+			"code", errFrame.Code,
+			"reason", errFrame.Message,
+		)
+	}
+}
+
 func MessageGenerator() func() string {
 	randGen := rand.New(rand.NewSource(time.Now().UnixNano()))
 
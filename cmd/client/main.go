@@ -11,19 +11,31 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
 	"github.com/gorilla/websocket"
 )
 
+// keepalive pings the server so that a dead connection fails the read and is
+// reconnected, the pings of the server are answered while reading
+var keepalive = common.Keepalive{
+	PingInterval: time.Second * 30,
+	PongWait:     time.Second * 60,
+	WriteWait:    time.Second * 10,
+}
+
 func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
 	host := os.Getenv("SERVICE_HOST")
 	port := os.Getenv("SERVICE_PORT")
+	room := os.Getenv("ROOM")
 	name := os.Getenv("CLIENT_ID")
+	apiKey := os.Getenv("API_KEY")
 
 	if host == "" {
 		host = "localhost"
@@ -37,12 +49,18 @@ func main() {
 		name = fmt.Sprintf("client_%d", randomInt)
 	}
 
+	if room == "" {
+		room = "common_room"
+	}
+
 	authUrl := fmt.Sprintf("http://%s:%s/auth", host, port)
-	listenUrl := fmt.Sprintf("ws://%s:%s/listen?client_id=%s", host, port, name)
+	refreshUrl := fmt.Sprintf("http://%s:%s/auth/refresh", host, port)
+	listenUrl := fmt.Sprintf("ws://%s:%s/listen?room=%s&format=json", host, port, room)
 
 	// Authenticate
 	postBody, _ := json.Marshal(map[string]string{
 		"client_id": name,
+		"secret":    apiKey,
 	})
 	client := http.Client{}
 	responseBody := bytes.NewBuffer(postBody)
@@ -63,8 +81,8 @@ func main() {
 		)
 		return
 	}
-	authMsg := model.ResponseMessage{}
-	err = json.Unmarshal(b, &authMsg)
+	authResp := model.AuthResponse{}
+	err = json.Unmarshal(b, &authResp)
 	if err != nil {
 		logger.Error(
 			"json unmarshal",
@@ -73,22 +91,60 @@ func main() {
 		return
 	}
 
-	// websocket connection
-	headers := map[string][]string{
-		"Signature": {authMsg.Message},
-	}
-	conn, _, err := websocket.DefaultDialer.Dial(listenUrl, headers)
-	if err != nil {
-		log.Fatal("ws dial:", err)
-	}
-
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	// cursor of the last printed message, used to resume after a reconnect
+	var cursor string
+
 Loop:
 	for {
+		url := listenUrl
+		if cursor != "" {
+			url = fmt.Sprintf("%s&since=%s", listenUrl, cursor)
+		}
+		// the token is only checked when connecting, renew it before reconnecting
+		if time.Now().Unix() >= authResp.ExpiresAt {
+			authResp, err = refreshToken(&client, refreshUrl, authResp.Token)
+			if err != nil {
+				log.Fatal("refresh token:", err)
+			}
+		}
+		headers := map[string][]string{
+			"Authorization": {"Bearer " + authResp.Token},
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(url, headers)
+		if err != nil {
+			log.Fatal("ws dial:", err)
+		}
+		heartbeat := keepalive.Start(conn)
+
+		readErr := make(chan error, 1)
+		go func() {
+			for {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					readErr <- err
+					return
+				}
+				frame := model.MessageFrame{}
+				if err := json.Unmarshal(message, &frame); err != nil {
+					logger.Error(
+						"json unmarshal frame",
+						"error", err,
+					)
+					continue
+				}
+				cursor = strconv.FormatInt(frame.ID, 10)
+				msgTime := time.UnixMilli(frame.Timestamp).Format("15:04")
+				fmt.Printf("[%s]\t%s\t%s\n", msgTime, frame.ClientID, frame.Message)
+			}
+		}()
+
 		select {
 		case <-sig:
+			heartbeat.Stop()
+			conn.SetWriteDeadline(keepalive.WriteDeadline())
 			err := conn.WriteMessage(websocket.CloseMessage, []byte("closing connection"))
 			if err != nil {
 				logger.Error(
@@ -98,19 +154,43 @@ Loop:
 			}
 			conn.Close()
 			break Loop
-		default:
-			_, message, err := conn.ReadMessage()
-			if err != nil {
-				logger.Error(
-					"ws connection read:",
-					"error", err,
-				)
-				return
-			}
-			fmt.Printf("%s", string(message))
+		case err := <-readErr:
+			logger.Error(
+				"ws connection read - reconnecting",
+				"error", err,
+				"since", cursor,
+			)
+			heartbeat.Stop()
+			conn.Close()
+			<-time.After(time.Second * 1)
 		}
 	}
 	logger.Info(
 		"terminating chat connection",
 	)
 }
+
+// refreshToken exchanges the token for a new one
+func refreshToken(client *http.Client, refreshUrl, token string) (model.AuthResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, refreshUrl, nil)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("client do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.AuthResponse{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	authResp := model.AuthResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return model.AuthResponse{}, fmt.Errorf("json decode: %w", err)
+	}
+	return authResp, nil
+}
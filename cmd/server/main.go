@@ -1,22 +1,43 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
+	chatv1 "github.com/dgdraganov/crispy-chat-service/api/chat/v1"
 	"github.com/dgdraganov/crispy-chat-service/internal/config"
 	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	grpchandler "github.com/dgdraganov/crispy-chat-service/internal/grpc/handler"
+	"github.com/dgdraganov/crispy-chat-service/internal/grpc/interceptor"
+	grpcserver "github.com/dgdraganov/crispy-chat-service/internal/grpc/server"
 	"github.com/dgdraganov/crispy-chat-service/internal/http/handler/auth"
+	"github.com/dgdraganov/crispy-chat-service/internal/http/handler/jwks"
 	"github.com/dgdraganov/crispy-chat-service/internal/http/handler/listen"
 	"github.com/dgdraganov/crispy-chat-service/internal/http/handler/push"
+	"github.com/dgdraganov/crispy-chat-service/internal/http/handler/rooms"
+	"github.com/dgdraganov/crispy-chat-service/internal/http/handler/ws"
 	"github.com/dgdraganov/crispy-chat-service/internal/http/middleware"
 	"github.com/dgdraganov/crispy-chat-service/internal/http/server"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+	"github.com/dgdraganov/crispy-chat-service/pkg/identity"
+	"github.com/dgdraganov/crispy-chat-service/pkg/memory"
+	"github.com/dgdraganov/crispy-chat-service/pkg/policy"
+	"github.com/dgdraganov/crispy-chat-service/pkg/ratelimit"
 	"github.com/dgdraganov/crispy-chat-service/pkg/redis"
 	"github.com/dgdraganov/crispy-chat-service/pkg/sign"
+	"github.com/dgdraganov/crispy-chat-service/pkg/sqlstore"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"google.golang.org/grpc"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
@@ -29,44 +50,184 @@ func main() {
 
 	// Middleware
 	i := middleware.NewRequestIdMiddleware(logger)
-	a := middleware.NewSignatureMiddleware(logger)
 	l := middleware.NewLologMiddleware(logger)
+	ip := middleware.NewClientIPMiddleware(conf.ClientIPHeader, conf.ClientIPTrustedHops, logger)
 
-	// Load private key
-	privateKey, err := sign.LoadPrivateKey(os.Getenv("PRIVATE_KEY"))
+	// Load signing keys
+	algorithm, err := sign.ParseAlgorithm(conf.SigningAlgorithm)
 	if err != nil {
-		panic(fmt.Sprintf("load private key: %s", err))
+		panic(fmt.Sprintf("load signing config: %s", err))
+	}
+	keys, signer, err := newTokenKeys(conf, algorithm)
+	if err != nil {
+		panic(fmt.Sprintf("load signing keys: %s", err))
 	}
 
 	// Instantiate core functionality
-	dSigner := sign.NewECDSA(privateKey, sign.NewSHA256Hasher(), sign.NewBase64Encoder())
-	redisStore := redis.New(conf.RedisAddress)
-	chatCore := core.New(dSigner, redisStore, logger)
+	store, err := newStore(conf)
+	if err != nil {
+		panic(fmt.Sprintf("create %s store: %s", conf.StoreBackend, err))
+	}
+	// a server without a signer issues no tokens and needs no identity provider
+	var idp core.IdentityProvider
+	if signer != nil {
+		idp, err = newIdentityProvider(conf)
+		if err != nil {
+			panic(fmt.Sprintf("create %s identity provider: %s", conf.IdentityProvider, err))
+		}
+	}
+	grants, err := newGrantStore(conf, store)
+	if err != nil {
+		panic(fmt.Sprintf("create %s grant store: %s", conf.ACLSource, err))
+	}
+	if err := core.ValidatePermissions(conf.ACLDefaultPermissions); err != nil {
+		panic(fmt.Sprintf("load acl config: %s", err))
+	}
+	aclConfig := core.ACLConfig{
+		DefaultPermissions: conf.ACLDefaultPermissions,
+	}
+	limiter, err := newRateLimiter(conf)
+	if err != nil {
+		panic(fmt.Sprintf("create %s rate limiter: %s", conf.RateLimitBackend, err))
+	}
+	rateLimitConfig, err := newRateLimitConfig(conf)
+	if err != nil {
+		panic(fmt.Sprintf("load rate limit config: %s", err))
+	}
+	hubPolicy, err := core.ParseSlowConsumerPolicy(conf.HubSlowConsumerPolicy)
+	if err != nil {
+		panic(fmt.Sprintf("load hub config: %s", err))
+	}
+	hubConfig := core.HubConfig{
+		BufferSize:  conf.HubBufferSize,
+		Policy:      hubPolicy,
+		BacklogSize: conf.HubBacklogSize,
+	}
+	tokenConfig := core.TokenConfig{
+		TTL:           conf.TokenTTL,
+		Audience:      conf.TokenAudience,
+		Scopes:        conf.TokenScopes,
+		RefreshWindow: conf.TokenRefreshWindow,
+		MaxAge:        conf.TokenMaxAge,
+	}
+	publishConfig := core.PublishConfig{
+		DedupWindow: conf.DedupWindow,
+	}
+	chatCore := core.New(signer, keys, store, idp, grants, limiter, core.NewValidationChain(conf.MaxMessageSize), core.NewSystemClock(), hubConfig, tokenConfig, aclConfig, rateLimitConfig, publishConfig, logger)
+
+	err = chatCore.CreateRoom(core.DefaultRoom)
+	if err != nil && !errors.Is(err, core.ErrRoomExists) {
+		panic(fmt.Sprintf("create default room: %s", err))
+	}
+
+	a := middleware.NewAuthMiddleware(chatCore, conf.SSEQueryToken, logger)
 
 	// Handlers
 	var authHandler http.Handler
 	authHandler = auth.NewHandler("POST", chatCore, logger)
 	authHandler = i.Id(l.Log(authHandler))
 
+	var refreshHandler http.Handler
+	refreshHandler = auth.NewRefreshHandler("POST", chatCore, logger)
+	refreshHandler = i.Id(l.Log(a.Token(refreshHandler)))
+
+	keepalive := common.Keepalive{
+		PingInterval: conf.WSPingInterval,
+		PongWait:     conf.WSPongWait,
+		WriteWait:    conf.WSWriteWait,
+		IdleTimeout:  conf.WSIdleTimeout,
+	}
+
 	var pushHandler http.Handler
-	pushHandler = push.NewHandler("GET", chatCore, logger)
-	pushHandler = i.Id(l.Log(a.Auth(pushHandler)))
+	pushHandler = push.NewHandler("GET", chatCore, int64(conf.MaxFrameSize), conf.RateLimitMaxViolations, keepalive, logger)
+	pushHandler = i.Id(l.Log(ip.IP(a.Auth(pushHandler))))
 
 	var listenHandler http.Handler
-	listenHandler = listen.NewHandler("GET", chatCore, logger)
-	listenHandler = i.Id(l.Log(a.Auth(listenHandler)))
+	listenHandler = listen.NewHandler("GET", chatCore, conf.SSEHeartbeatInterval, keepalive, logger)
+	listenHandler = i.Id(l.Log(a.StreamAuth(listenHandler)))
+
+	var wsHandler http.Handler
+	wsHandler = ws.NewHandler("GET", chatCore, int64(conf.MaxFrameSize), conf.RateLimitMaxViolations, keepalive, logger)
+	wsHandler = i.Id(l.Log(ip.IP(a.Auth(wsHandler))))
+
+	var roomsHandler http.Handler
+	roomsHandler = rooms.NewHandler("/rooms", chatCore, int64(conf.MaxFrameSize), logger)
+	roomsHandler = i.Id(l.Log(ip.IP(a.Auth(roomsHandler))))
+
+	var jwksHandler http.Handler
+	jwksHandler = jwks.NewHandler("GET", keys, logger)
+	jwksHandler = i.Id(l.Log(jwksHandler))
 
 	// Router
 	mux := &http.ServeMux{}
-	mux.Handle("/auth", authHandler)
+	if signer != nil {
+		mux.Handle("/auth", authHandler)
+		mux.Handle("/auth/refresh", refreshHandler)
+	}
 	mux.Handle("/push", pushHandler)
 	mux.Handle("/listen", listenHandler)
+	mux.Handle("/ws", wsHandler)
+	mux.Handle("/rooms", roomsHandler)
+	mux.Handle("/rooms/", roomsHandler)
+	mux.Handle("/.well-known/jwks.json", jwksHandler)
 
 	server := server.NewHTTP(conf.Port, mux, logger)
 
 	// Start the server asynchronously
 	server.Start(conf.Port)
 
+	// The gRPC API is served on its own port when GRPC_PORT is set
+	var grpcServer interface{ Shutdown() }
+	if conf.GRPCPort != "" {
+		requests := interceptor.NewRequestInterceptor(logger)
+		authenticator := interceptor.NewAuthInterceptor(chatCore, logger, chatv1.ChatService_Auth_FullMethodName)
+		gs := grpc.NewServer(
+			grpc.ChainUnaryInterceptor(requests.Unary(), authenticator.Unary()),
+			grpc.ChainStreamInterceptor(requests.Stream(), authenticator.Stream()),
+		)
+		chatv1.RegisterChatServiceServer(gs, grpchandler.NewChatServer(chatCore, logger))
+
+		s := grpcserver.NewGRPC(gs, logger)
+		s.Start(conf.GRPCPort)
+		grpcServer = s
+	}
+
+	// Reload the signing keys on SIGHUP and whenever the key directory or the
+	// downloaded key set changes
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	if reloadable, ok := keys.(reloadableKeys); ok {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go func() {
+			for {
+				select {
+				case <-reloadCtx.Done():
+					return
+				case <-reload:
+					if err := reloadable.Reload(); err != nil {
+						logger.Error(
+							"reload signing keys",
+							"error", err,
+						)
+						continue
+					}
+					logger.Info("signing keys reloaded")
+				}
+			}
+		}()
+		if conf.KeyDir != "" || conf.JWKSURL != "" {
+			go reloadable.Watch(reloadCtx, conf.KeyReloadInterval, func(err error) {
+				logger.Error(
+					"reload signing keys",
+					"error", err,
+					"key_dir", conf.KeyDir,
+					"jwks_url", conf.JWKSURL,
+				)
+			})
+		}
+	}
+
 	// Graceful shutdown
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -74,4 +235,178 @@ func main() {
 
 	logger.Info("shut down signal received")
 	server.Shutdown()
+	if grpcServer != nil {
+		grpcServer.Shutdown()
+	}
+}
+
+// chatStore is implemented by every db store backend
+type chatStore interface {
+	core.DBClient
+	core.GrantStore
+}
+
+// newStore creates the db store selected by the STORE_BACKEND config
+func newStore(conf config.ServerConfig) (chatStore, error) {
+	switch conf.StoreBackend {
+	case config.StoreBackendMemory:
+		return memory.New(), nil
+	case config.StoreBackendSQL:
+		store, err := sqlstore.New(conf.SQLDriver, conf.SQLDSN, conf.SQLPollInterval)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		store, err := redis.New(conf.RedisAddress)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+}
+
+// newGrantStore creates the source of the room grants selected by the ACL_SOURCE config
+func newGrantStore(conf config.ServerConfig, store chatStore) (core.GrantStore, error) {
+	if conf.ACLSource == config.ACLSourceFile {
+		filePolicy, err := policy.NewFile(conf.ACLPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		return filePolicy, nil
+	}
+	return store, nil
+}
+
+// newRateLimiter creates the rate limiter selected by the RATE_LIMIT_BACKEND config
+func newRateLimiter(conf config.ServerConfig) (core.RateLimiter, error) {
+	if conf.RateLimitBackend == config.RateLimitBackendRedis {
+		limiter, err := ratelimit.NewRedis(conf.RedisAddress)
+		if err != nil {
+			return nil, err
+		}
+		return limiter, nil
+	}
+	return ratelimit.NewMemory(), nil
+}
+
+// newRateLimitConfig parses the RATE_LIMIT_CLIENT, RATE_LIMIT_ROOM and RATE_LIMIT_IP config
+func newRateLimitConfig(conf config.ServerConfig) (core.RateLimitConfig, error) {
+	client, err := core.ParseRateLimit(conf.RateLimitClient)
+	if err != nil {
+		return core.RateLimitConfig{}, fmt.Errorf("client: %w", err)
+	}
+	room, err := core.ParseRateLimit(conf.RateLimitRoom)
+	if err != nil {
+		return core.RateLimitConfig{}, fmt.Errorf("room: %w", err)
+	}
+	ip, err := core.ParseRateLimit(conf.RateLimitIP)
+	if err != nil {
+		return core.RateLimitConfig{}, fmt.Errorf("ip: %w", err)
+	}
+
+	return core.RateLimitConfig{
+		Client: client,
+		Room:   room,
+		IP:     ip,
+	}, nil
+}
+
+// newIdentityProvider creates the identity provider selected by the IDENTITY_PROVIDER config
+func newIdentityProvider(conf config.ServerConfig) (core.IdentityProvider, error) {
+	switch conf.IdentityProvider {
+	case config.IdentityProviderHtpasswd:
+		provider, err := identity.NewHtpasswd(conf.HtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	case config.IdentityProviderIntrospection:
+		client := &http.Client{Timeout: time.Second * 10}
+		return identity.NewIntrospection(
+			conf.IntrospectionURL,
+			conf.IntrospectionClientID,
+			conf.IntrospectionClientSecret,
+			client,
+		), nil
+	default:
+		return identity.NewStatic(conf.StaticAPIKeys), nil
+	}
+}
+
+// tokenKeys verifies the tokens and publishes the keys that verify them
+type tokenKeys interface {
+	core.Verifier
+	KeySet() (sign.JSONWebKeySet, error)
+}
+
+// reloadableKeys are token keys that can be loaded again while the server runs
+type reloadableKeys interface {
+	Reload() error
+	Watch(ctx context.Context, interval time.Duration, onError func(error))
+}
+
+// newTokenKeys creates the keys that verify the tokens and the signer that issues
+// them. With the PUBLIC_KEY or JWKS_URL config the server only verifies tokens
+// issued by another server and the signer is nil.
+func newTokenKeys(conf config.ServerConfig, algorithm sign.Algorithm) (tokenKeys, core.Signer, error) {
+	hasher, encoder := sign.NewSHA256Hasher(), sign.NewBase64Encoder()
+
+	switch {
+	case conf.JWKSURL != "":
+		client := &http.Client{Timeout: time.Second * 10}
+		verifier, err := sign.NewRemoteKeySetVerifier(client, conf.JWKSURL, hasher, encoder)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load key set: %w", err)
+		}
+		return verifier, nil, nil
+	case conf.PublicKey != "":
+		publicKey, err := sign.LoadPublicKey(conf.PublicKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load public key: %w", err)
+		}
+		key, err := sign.NewJSONWebKey(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		verifier, err := sign.NewKeySetVerifier(sign.JSONWebKeySet{Keys: []sign.JSONWebKey{key}}, hasher, encoder)
+		if err != nil {
+			return nil, nil, err
+		}
+		return verifier, nil, nil
+	}
+
+	keySource, err := newKeySource(conf, algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyring, err := sign.NewKeyring(keySource, algorithm, conf.KeyGracePeriod, hasher, encoder)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyring, keyring, nil
+}
+
+// newKeySource creates the signing key source, the KEY_DIR directory when it is
+// configured and the PRIVATE_KEY key otherwise
+func newKeySource(conf config.ServerConfig, algorithm sign.Algorithm) (sign.KeySource, error) {
+	if conf.KeyDir != "" {
+		return sign.NewDirSource(conf.KeyDir), nil
+	}
+
+	var privateKey crypto.PrivateKey
+	var err error
+	if algorithm == sign.AlgorithmHMAC {
+		privateKey, err = sign.LoadSecretKey(conf.PrivateKey)
+	} else {
+		privateKey, err = sign.LoadPrivateKey(conf.PrivateKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load private key: %w", err)
+	}
+	source, err := sign.NewStaticSource(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
 }
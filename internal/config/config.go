@@ -4,20 +4,151 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
 )
 
 var errMissingEnvVariable error = errors.New("environment variable not found")
+var errInvalidEnvVariable error = errors.New("environment variable not valid")
 
 type ServerConfig struct {
-	Port         string
-	RedisAddress string
-	PrivateKey   string
+	Port       string
+	GRPCPort   string
+	PrivateKey string
+
+	// PublicKey and JWKSURL run the server without signing keys, it then only
+	// verifies the tokens issued by another server
+	PublicKey string
+	JWKSURL   string
+
+	SigningAlgorithm  string
+	KeyDir            string
+	KeyGracePeriod    time.Duration
+	KeyReloadInterval time.Duration
+
+	StoreBackend    string
+	RedisAddress    string
+	SQLDriver       string
+	SQLDSN          string
+	SQLPollInterval time.Duration
+
+	HubBufferSize         int
+	HubSlowConsumerPolicy string
+	HubBacklogSize        int
+
+	TokenTTL           time.Duration
+	TokenAudience      string
+	TokenScopes        []string
+	TokenRefreshWindow time.Duration
+	TokenMaxAge        time.Duration
+
+	MaxFrameSize   int
+	MaxMessageSize int
+	DedupWindow    time.Duration
+
+	SSEHeartbeatInterval time.Duration
+	// SSEQueryToken allows event stream requests to pass the access token in
+	// the query parameter
+	SSEQueryToken bool
+
+	WSPingInterval time.Duration
+	WSPongWait     time.Duration
+	WSWriteWait    time.Duration
+	WSIdleTimeout  time.Duration
+
+	RateLimitBackend       string
+	RateLimitClient        string
+	RateLimitRoom          string
+	RateLimitIP            string
+	RateLimitMaxViolations int
+	ClientIPHeader         string
+	ClientIPTrustedHops    int
+
+	ACLSource             string
+	ACLPolicyFile         string
+	ACLDefaultPermissions []string
+
+	IdentityProvider          string
+	StaticAPIKeys             map[string]model.Identity
+	HtpasswdFile              string
+	IntrospectionURL          string
+	IntrospectionClientID     string
+	IntrospectionClientSecret string
 }
 
 const (
-	serverPortEnvString   = "SERVER_PORT"
-	redisArrdessEnvString = "REDIS_ADDRESS"
-	privateKeyEnvString   = "PRIVATE_KEY"
+	serverPortEnvString             = "SERVER_PORT"
+	grpcPortEnvString               = "GRPC_PORT"
+	redisArrdessEnvString           = "REDIS_ADDRESS"
+	privateKeyEnvString             = "PRIVATE_KEY"
+	publicKeyEnvString              = "PUBLIC_KEY"
+	jwksURLEnvString                = "JWKS_URL"
+	signingAlgorithmEnvString       = "SIGNING_ALGORITHM"
+	keyDirEnvString                 = "KEY_DIR"
+	keyGracePeriodEnvString         = "KEY_GRACE_PERIOD"
+	keyReloadIntervalEnvString      = "KEY_RELOAD_INTERVAL"
+	hubBufferSizeEnvString          = "HUB_BUFFER_SIZE"
+	hubSlowConsumerPolicyEnvString  = "HUB_SLOW_CONSUMER_POLICY"
+	hubBacklogSizeEnvString         = "HUB_BACKLOG_SIZE"
+	storeBackendEnvString           = "STORE_BACKEND"
+	sqlDriverEnvString              = "SQL_DRIVER"
+	sqlDSNEnvString                 = "SQL_DSN"
+	sqlPollIntervalEnvString        = "SQL_POLL_INTERVAL"
+	tokenTTLEnvString               = "TOKEN_TTL"
+	tokenAudienceEnvString          = "TOKEN_AUDIENCE"
+	tokenScopesEnvString            = "TOKEN_SCOPES"
+	tokenRefreshWindowEnvString     = "TOKEN_REFRESH_WINDOW"
+	tokenMaxAgeEnvString            = "TOKEN_MAX_AGE"
+	maxFrameSizeEnvString           = "MAX_FRAME_SIZE"
+	maxMessageSizeEnvString         = "MAX_MESSAGE_SIZE"
+	dedupWindowEnvString            = "DEDUP_WINDOW"
+	sseHeartbeatIntervalEnvString   = "SSE_HEARTBEAT_INTERVAL"
+	sseQueryTokenEnvString          = "SSE_QUERY_TOKEN"
+	wsPingIntervalEnvString         = "WS_PING_INTERVAL"
+	wsPongWaitEnvString             = "WS_PONG_WAIT"
+	wsWriteWaitEnvString            = "WS_WRITE_WAIT"
+	wsIdleTimeoutEnvString          = "WS_IDLE_TIMEOUT"
+	rateLimitBackendEnvString       = "RATE_LIMIT_BACKEND"
+	rateLimitClientEnvString        = "RATE_LIMIT_CLIENT"
+	rateLimitRoomEnvString          = "RATE_LIMIT_ROOM"
+	rateLimitIPEnvString            = "RATE_LIMIT_IP"
+	rateLimitMaxViolationsEnvString = "RATE_LIMIT_MAX_VIOLATIONS"
+	clientIPHeaderEnvString         = "CLIENT_IP_HEADER"
+	clientIPTrustedHopsEnvString    = "CLIENT_IP_TRUSTED_HOPS"
+	aclSourceEnvString              = "ACL_SOURCE"
+	aclPolicyFileEnvString          = "ACL_POLICY_FILE"
+	aclDefaultPermissionsEnvString  = "ACL_DEFAULT_PERMISSIONS"
+	identityProviderEnvString       = "IDENTITY_PROVIDER"
+	staticAPIKeysEnvString          = "STATIC_API_KEYS"
+	htpasswdFileEnvString           = "HTPASSWD_FILE"
+	introspectionURLEnvString       = "INTROSPECTION_URL"
+	introspectionClientIDEnvString  = "INTROSPECTION_CLIENT_ID"
+	introspectionSecretEnvString    = "INTROSPECTION_CLIENT_SECRET"
+)
+
+const (
+	StoreBackendRedis  = "redis"
+	StoreBackendMemory = "memory"
+	StoreBackendSQL    = "sql"
+)
+
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendRedis  = "redis"
+)
+
+const (
+	ACLSourceStore = "store"
+	ACLSourceFile  = "file"
+)
+
+const (
+	IdentityProviderStatic        = "static"
+	IdentityProviderHtpasswd      = "htpasswd"
+	IdentityProviderIntrospection = "introspection"
 )
 
 // NewServerConfig is a constructor function for the ServerConfig type
@@ -27,18 +158,347 @@ func NewServer() (ServerConfig, error) {
 		return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, serverPortEnvString)
 	}
 
+	// a server with PUBLIC_KEY or JWKS_URL only verifies tokens and needs no signing keys
+	publicKey := lookupString(publicKeyEnvString, "")
+	jwksURL := lookupString(jwksURLEnvString, "")
+	if publicKey != "" && jwksURL != "" {
+		return ServerConfig{}, fmt.Errorf("%w: only one of %s and %s may be set", errInvalidEnvVariable, publicKeyEnvString, jwksURLEnvString)
+	}
+	verifyOnly := publicKey != "" || jwksURL != ""
+
+	// the keys are loaded from KEY_DIR when it is set, otherwise PRIVATE_KEY is the only key
+	keyDir := lookupString(keyDirEnvString, "")
 	privKey, ok := os.LookupEnv(privateKeyEnvString)
-	if !ok {
+	if !ok && keyDir == "" && !verifyOnly {
 		return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, privateKeyEnvString)
 	}
-	redisAddr, ok := os.LookupEnv(redisArrdessEnvString)
-	if !ok {
-		return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, redisArrdessEnvString)
+	keyGracePeriod, err := lookupDuration(keyGracePeriodEnvString, time.Hour*2)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	keyReloadInterval, err := lookupDuration(keyReloadIntervalEnvString, time.Second*10)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	storeBackend := lookupString(storeBackendEnvString, StoreBackendRedis)
+
+	var redisAddr, sqlDriver, sqlDSN string
+	switch storeBackend {
+	case StoreBackendRedis:
+		redisAddr, ok = os.LookupEnv(redisArrdessEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, redisArrdessEnvString)
+		}
+	case StoreBackendSQL:
+		sqlDriver, ok = os.LookupEnv(sqlDriverEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, sqlDriverEnvString)
+		}
+		sqlDSN, ok = os.LookupEnv(sqlDSNEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, sqlDSNEnvString)
+		}
+	case StoreBackendMemory:
+	default:
+		return ServerConfig{}, fmt.Errorf("%w: %s", errInvalidEnvVariable, storeBackendEnvString)
+	}
+
+	sqlPollInterval, err := lookupDuration(sqlPollIntervalEnvString, time.Second)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	hubBufferSize, err := lookupInt(hubBufferSizeEnvString, 256)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	hubBacklogSize, err := lookupInt(hubBacklogSizeEnvString, 1000)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	tokenTTL, err := lookupDuration(tokenTTLEnvString, time.Minute*15)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	tokenRefreshWindow, err := lookupDuration(tokenRefreshWindowEnvString, time.Hour)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	tokenMaxAge, err := lookupDuration(tokenMaxAgeEnvString, time.Hour*24)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	tokenScopes := strings.Fields(lookupString(tokenScopesEnvString, "chat:read chat:write"))
+
+	maxFrameSize, err := lookupInt(maxFrameSizeEnvString, 16384)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	maxMessageSize, err := lookupInt(maxMessageSizeEnvString, 4096)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	dedupWindow, err := lookupDuration(dedupWindowEnvString, time.Minute*10)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	sseHeartbeatInterval, err := lookupDuration(sseHeartbeatIntervalEnvString, time.Second*15)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	sseQueryToken, err := lookupBool(sseQueryTokenEnvString, true)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	wsPingInterval, err := lookupNonNegativeDuration(wsPingIntervalEnvString, time.Second*30)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	wsPongWait, err := lookupNonNegativeDuration(wsPongWaitEnvString, time.Second*60)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	// the pings must be sent before the pong wait passes
+	if wsPongWait > 0 && (wsPingInterval <= 0 || wsPingInterval >= wsPongWait) {
+		return ServerConfig{}, fmt.Errorf("%w: %s must be less than %s", errInvalidEnvVariable, wsPingIntervalEnvString, wsPongWaitEnvString)
+	}
+	wsWriteWait, err := lookupNonNegativeDuration(wsWriteWaitEnvString, time.Second*10)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	wsIdleTimeout, err := lookupNonNegativeDuration(wsIdleTimeoutEnvString, 0)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	rateLimitBackend := lookupString(rateLimitBackendEnvString, RateLimitBackendMemory)
+	switch rateLimitBackend {
+	case RateLimitBackendMemory:
+	case RateLimitBackendRedis:
+		redisAddr, ok = os.LookupEnv(redisArrdessEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, redisArrdessEnvString)
+		}
+	default:
+		return ServerConfig{}, fmt.Errorf("%w: %s", errInvalidEnvVariable, rateLimitBackendEnvString)
+	}
+	rateLimitMaxViolations, err := lookupInt(rateLimitMaxViolationsEnvString, 10)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	clientIPTrustedHops, err := lookupInt(clientIPTrustedHopsEnvString, 1)
+	if err != nil || clientIPTrustedHops == 0 {
+		return ServerConfig{}, fmt.Errorf("%w: %s", errInvalidEnvVariable, clientIPTrustedHopsEnvString)
+	}
+
+	aclSource := lookupString(aclSourceEnvString, ACLSourceStore)
+	var aclPolicyFile string
+	switch aclSource {
+	case ACLSourceStore:
+	case ACLSourceFile:
+		aclPolicyFile, ok = os.LookupEnv(aclPolicyFileEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, aclPolicyFileEnvString)
+		}
+	default:
+		return ServerConfig{}, fmt.Errorf("%w: %s", errInvalidEnvVariable, aclSourceEnvString)
+	}
+	// ACL_DEFAULT_PERMISSIONS may be set to an empty value to deny access to rooms without grants
+	aclDefaultPermissions := "room:read room:write"
+	if value, ok := os.LookupEnv(aclDefaultPermissionsEnvString); ok {
+		aclDefaultPermissions = value
+	}
+
+	identityProvider := lookupString(identityProviderEnvString, IdentityProviderStatic)
+
+	var staticAPIKeys map[string]model.Identity
+	var htpasswdFile, introspectionURL string
+	switch {
+	case verifyOnly:
+		// no tokens are issued, so the clients are not identified
+	case identityProvider == IdentityProviderStatic:
+		apiKeys, ok := os.LookupEnv(staticAPIKeysEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, staticAPIKeysEnvString)
+		}
+		staticAPIKeys, err = parseAPIKeys(apiKeys)
+		if err != nil {
+			return ServerConfig{}, fmt.Errorf("%w: %s: %s", errInvalidEnvVariable, staticAPIKeysEnvString, err)
+		}
+	case identityProvider == IdentityProviderHtpasswd:
+		htpasswdFile, ok = os.LookupEnv(htpasswdFileEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, htpasswdFileEnvString)
+		}
+	case identityProvider == IdentityProviderIntrospection:
+		introspectionURL, ok = os.LookupEnv(introspectionURLEnvString)
+		if !ok {
+			return ServerConfig{}, fmt.Errorf("%w: %s", errMissingEnvVariable, introspectionURLEnvString)
+		}
+	default:
+		return ServerConfig{}, fmt.Errorf("%w: %s", errInvalidEnvVariable, identityProviderEnvString)
 	}
 
 	return ServerConfig{
-		Port:         port,
-		PrivateKey:   privKey,
-		RedisAddress: redisAddr,
+		Port:                  port,
+		GRPCPort:              os.Getenv(grpcPortEnvString),
+		PrivateKey:            privKey,
+		PublicKey:             publicKey,
+		JWKSURL:               jwksURL,
+		SigningAlgorithm:      lookupString(signingAlgorithmEnvString, "ecdsa"),
+		KeyDir:                keyDir,
+		KeyGracePeriod:        keyGracePeriod,
+		KeyReloadInterval:     keyReloadInterval,
+		StoreBackend:          storeBackend,
+		RedisAddress:          redisAddr,
+		SQLDriver:             sqlDriver,
+		SQLDSN:                sqlDSN,
+		SQLPollInterval:       sqlPollInterval,
+		HubBufferSize:         hubBufferSize,
+		HubSlowConsumerPolicy: lookupString(hubSlowConsumerPolicyEnvString, "drop"),
+		HubBacklogSize:        hubBacklogSize,
+		TokenTTL:              tokenTTL,
+		TokenAudience:         lookupString(tokenAudienceEnvString, "crispy-chat"),
+		TokenScopes:           tokenScopes,
+		TokenRefreshWindow:    tokenRefreshWindow,
+		TokenMaxAge:           tokenMaxAge,
+
+		MaxFrameSize:   maxFrameSize,
+		MaxMessageSize: maxMessageSize,
+		DedupWindow:    dedupWindow,
+
+		SSEHeartbeatInterval: sseHeartbeatInterval,
+		SSEQueryToken:        sseQueryToken,
+		WSPingInterval:       wsPingInterval,
+		WSPongWait:           wsPongWait,
+		WSWriteWait:          wsWriteWait,
+		WSIdleTimeout:        wsIdleTimeout,
+
+		RateLimitBackend:       rateLimitBackend,
+		RateLimitClient:        lookupRateLimit(rateLimitClientEnvString, "5/1s"),
+		RateLimitRoom:          lookupRateLimit(rateLimitRoomEnvString, "50/1s"),
+		RateLimitIP:            lookupRateLimit(rateLimitIPEnvString, "20/1s"),
+		RateLimitMaxViolations: rateLimitMaxViolations,
+		ClientIPHeader:         os.Getenv(clientIPHeaderEnvString),
+		ClientIPTrustedHops:    clientIPTrustedHops,
+
+		ACLSource:             aclSource,
+		ACLPolicyFile:         aclPolicyFile,
+		ACLDefaultPermissions: strings.Fields(aclDefaultPermissions),
+
+		IdentityProvider:          identityProvider,
+		StaticAPIKeys:             staticAPIKeys,
+		HtpasswdFile:              htpasswdFile,
+		IntrospectionURL:          introspectionURL,
+		IntrospectionClientID:     os.Getenv(introspectionClientIDEnvString),
+		IntrospectionClientSecret: os.Getenv(introspectionSecretEnvString),
 	}, nil
 }
+
+// lookupString returns the value of an optional environment variable
+func lookupString(key, defaultValue string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// lookupRateLimit returns the value of an optional rate limit environment
+// variable, it may be set to an empty value to disable the limit
+func lookupRateLimit(key, defaultValue string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	return value
+}
+
+// lookupInt returns the value of an optional numeric environment variable
+func lookupInt(key string, defaultValue int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidEnvVariable, key)
+	}
+	return number, nil
+}
+
+// lookupBool returns the value of an optional boolean environment variable, e.g. "false"
+func lookupBool(key string, defaultValue bool) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", errInvalidEnvVariable, key)
+	}
+	return b, nil
+}
+
+// lookupDuration returns the value of an optional duration environment variable, e.g. "500ms"
+func lookupDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidEnvVariable, key)
+	}
+	return duration, nil
+}
+
+// lookupNonNegativeDuration works like lookupDuration but also accepts "0",
+// which disables the setting
+func lookupNonNegativeDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidEnvVariable, key)
+	}
+	return duration, nil
+}
+
+// parseAPIKeys parses a comma separated list of "client_id:api_key" pairs into a
+// map from API key to the identity it belongs to. A pair may be followed by
+// ":scopes" with the space separated scopes of the client.
+func parseAPIKeys(value string) (map[string]model.Identity, error) {
+	keys := make(map[string]model.Identity)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		// the scopes contain colons as well, e.g. chat:read
+		fields := strings.SplitN(pair, ":", 3)
+		if len(fields) < 2 || fields[0] == "" || fields[1] == "" {
+			return nil, errors.New("expected client_id:api_key pairs")
+		}
+		clientID, key := fields[0], fields[1]
+		if _, ok := keys[key]; ok {
+			return nil, fmt.Errorf("duplicate API key for %s", clientID)
+		}
+		identity := model.Identity{ClientID: clientID}
+		if len(fields) == 3 {
+			identity.Scopes = strings.Fields(fields[2])
+		}
+		keys[key] = identity
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no API keys")
+	}
+	return keys, nil
+}
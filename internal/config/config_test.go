@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewServerKeepalive(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    [4]time.Duration
+		wantErr error
+	}{
+		{
+			name: "defaults",
+			want: [4]time.Duration{30 * time.Second, 60 * time.Second, 10 * time.Second, 0},
+		},
+		{
+			name: "all disabled",
+			env:  map[string]string{"WS_PING_INTERVAL": "0", "WS_PONG_WAIT": "0", "WS_WRITE_WAIT": "0", "WS_IDLE_TIMEOUT": "0"},
+			want: [4]time.Duration{0, 0, 0, 0},
+		},
+		{
+			name: "pings without pong wait",
+			env:  map[string]string{"WS_PONG_WAIT": "0s", "WS_IDLE_TIMEOUT": "5m"},
+			want: [4]time.Duration{30 * time.Second, 0, 10 * time.Second, 5 * time.Minute},
+		},
+		{
+			name:    "pong wait without pings",
+			env:     map[string]string{"WS_PING_INTERVAL": "0"},
+			wantErr: errInvalidEnvVariable,
+		},
+		{
+			name:    "negative write wait",
+			env:     map[string]string{"WS_WRITE_WAIT": "-1s"},
+			wantErr: errInvalidEnvVariable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SERVER_PORT", "9205")
+			t.Setenv("PRIVATE_KEY", "key")
+			t.Setenv("STORE_BACKEND", "memory")
+			t.Setenv("STATIC_API_KEYS", "Jim:k1")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			conf, err := NewServer()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := [4]time.Duration{conf.WSPingInterval, conf.WSPongWait, conf.WSWriteWait, conf.WSIdleTimeout}
+			if got != tt.want {
+				t.Fatalf("got ping interval, pong wait, write wait and idle timeout %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerSSEQueryToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    bool
+		wantErr error
+	}{
+		{name: "default", want: true},
+		{name: "disabled", value: "false", want: false},
+		{name: "invalid", value: "sometimes", wantErr: errInvalidEnvVariable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SERVER_PORT", "9205")
+			t.Setenv("PRIVATE_KEY", "key")
+			t.Setenv("STORE_BACKEND", "memory")
+			t.Setenv("STATIC_API_KEYS", "Jim:k1")
+			t.Setenv("SSE_QUERY_TOKEN", tt.value)
+
+			conf, err := NewServer()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && conf.SSEQueryToken != tt.want {
+				t.Fatalf("got query token %t, want %t", conf.SSEQueryToken, tt.want)
+			}
+		})
+	}
+}
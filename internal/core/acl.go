@@ -0,0 +1,148 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+var ErrPermissionDenied error = errors.New("permission denied")
+var ErrInvalidPermission error = errors.New("permission not valid")
+var ErrGrantNotFound error = errors.New("grant not found")
+var ErrGrantsReadOnly error = errors.New("grants cannot be changed through the service")
+
+const (
+	PermissionRoomRead  = "room:read"
+	PermissionRoomWrite = "room:write"
+	// PermissionRoomAdmin allows managing the room's grants and implies the other permissions
+	PermissionRoomAdmin = "room:admin"
+)
+
+// AnyClient is the client ID of grants that apply to every client
+const AnyClient = "*"
+
+// ACLConfig holds the settings of the room authorization
+type ACLConfig struct {
+	// DefaultPermissions are given to every client in rooms without any grants
+	DefaultPermissions []string
+}
+
+// ValidatePermissions checks that every permission is a known room permission
+func ValidatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		switch permission {
+		case PermissionRoomRead, PermissionRoomWrite, PermissionRoomAdmin:
+		default:
+			return fmt.Errorf("permission %q: %w", permission, ErrInvalidPermission)
+		}
+	}
+	return nil
+}
+
+// Authorize checks that the principal has the permission in the room. Clients
+// holding the rooms:admin scope have every permission in every room. In rooms
+// without grants every client has the configured default permissions.
+func (chat *chatService) Authorize(principal model.Principal, room, permission string) error {
+	if principal.HasScope(ScopeRoomsAdmin) {
+		return nil
+	}
+
+	permissions, err := chat.permissions(principal.ClientID, room)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(permissions, permission) || slices.Contains(permissions, PermissionRoomAdmin) {
+		return nil
+	}
+
+	return fmt.Errorf("%s in room %q: %w", permission, room, ErrPermissionDenied)
+}
+
+// Grants returns the grants of the room ordered by client ID
+func (chat *chatService) Grants(room string) ([]model.Grant, error) {
+	if err := chat.CheckRoom(room); err != nil {
+		return nil, err
+	}
+
+	grants, err := chat.grants.Grants(room)
+	if err != nil {
+		return nil, fmt.Errorf("grant store grants: %w", err)
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].ClientID < grants[j].ClientID
+	})
+	return grants, nil
+}
+
+// SetGrant replaces the permissions of the client in the room
+func (chat *chatService) SetGrant(room, clientID string, permissions []string) error {
+	writer, ok := chat.grants.(GrantWriter)
+	if !ok {
+		return ErrGrantsReadOnly
+	}
+	if clientID != AnyClient {
+		if err := validateClientID(clientID); err != nil {
+			return fmt.Errorf("invalid client id: %w", err)
+		}
+	}
+	if len(permissions) == 0 {
+		return fmt.Errorf("no permissions: %w", ErrInvalidPermission)
+	}
+	if err := ValidatePermissions(permissions); err != nil {
+		return err
+	}
+	if err := chat.CheckRoom(room); err != nil {
+		return err
+	}
+
+	grant := model.Grant{
+		ClientID:    clientID,
+		Permissions: permissions,
+	}
+	if err := writer.SetGrant(room, grant); err != nil {
+		return fmt.Errorf("grant store set grant: %w", err)
+	}
+	return nil
+}
+
+// DeleteGrant removes the grant of the client in the room
+func (chat *chatService) DeleteGrant(room, clientID string) error {
+	writer, ok := chat.grants.(GrantWriter)
+	if !ok {
+		return ErrGrantsReadOnly
+	}
+	if err := chat.CheckRoom(room); err != nil {
+		return err
+	}
+
+	deleted, err := writer.DeleteGrant(room, clientID)
+	if err != nil {
+		return fmt.Errorf("grant store delete grant: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("client %q in room %q: %w", clientID, room, ErrGrantNotFound)
+	}
+	return nil
+}
+
+// permissions returns the union of the client's permissions granted in the room
+func (chat *chatService) permissions(clientID, room string) ([]string, error) {
+	grants, err := chat.grants.Grants(room)
+	if err != nil {
+		return nil, fmt.Errorf("grant store grants: %w", err)
+	}
+	if len(grants) == 0 {
+		return chat.aclConfig.DefaultPermissions, nil
+	}
+
+	permissions := []string{}
+	for _, grant := range grants {
+		if grant.ClientID == clientID || grant.ClientID == AnyClient {
+			permissions = append(permissions, grant.Permissions...)
+		}
+	}
+	return permissions, nil
+}
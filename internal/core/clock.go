@@ -0,0 +1,53 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidTimezone error = errors.New("unknown timezone")
+
+// Clock provides the current time, it makes the time of stored messages predictable in tests
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct {
+}
+
+// NewSystemClock is a constructor function for the systemClock type
+func NewSystemClock() *systemClock {
+	return &systemClock{}
+}
+
+// Now returns the current UTC time
+func (c *systemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// ParseTimezone loads the location messages are rendered in, an empty name means UTC
+func ParseTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("timezone %q: %w", name, ErrInvalidTimezone)
+	}
+	return loc, nil
+}
+
+// toMillis converts a time to the milliseconds since the Unix epoch stored with messages,
+// the zero time is stored as 0
+func toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// fromMillis converts milliseconds since the Unix epoch to a time in the given location
+func fromMillis(ms int64, loc *time.Location) time.Time {
+	return time.UnixMilli(ms).In(loc)
+}
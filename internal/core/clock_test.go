@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+func TestMessageTimes(t *testing.T) {
+	received := time.Date(2024, 6, 10, 12, 34, 56, 789_654_321, time.UTC)
+	sentAt := received.Add(-1500 * time.Millisecond)
+	chat := newTestChat(t, newFakeClock(received), HubConfig{BufferSize: 16}, TokenConfig{})
+
+	cursor, err := chat.Publish(context.Background(), "Jim", DefaultRoom, "", "hello", sentAt)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	// the receive time in milliseconds is the sort key of the message
+	if want := received.UnixMilli(); cursor != want {
+		t.Fatalf("got cursor %d, want %d", cursor, want)
+	}
+
+	sub, err := chat.ReadMessages(context.Background(), "Jim", DefaultRoom, 0)
+	if err != nil {
+		t.Fatalf("read messages: %v", err)
+	}
+	defer sub.Close()
+
+	var frame model.MessageFrame
+	select {
+	case frame = <-sub.Messages():
+	case <-time.After(2 * time.Second):
+		t.Fatal("published message not received")
+	}
+	if frame.Timestamp != 1718022896789 {
+		t.Fatalf("got timestamp %d, want millisecond precision 1718022896789", frame.Timestamp)
+	}
+	if frame.SentAt != 1718022895289 {
+		t.Fatalf("got sent at %d, want millisecond precision 1718022895289", frame.SentAt)
+	}
+
+	tests := []struct {
+		timezone string
+		wantTime string
+		wantText string
+	}{
+		{timezone: "", wantTime: "2024-06-10T12:34:56.789Z", wantText: "[12:34]"},
+		{timezone: "Asia/Kolkata", wantTime: "2024-06-10T18:04:56.789+05:30", wantText: "[18:04]"},
+		// daylight saving time is in effect in June
+		{timezone: "America/New_York", wantTime: "2024-06-10T08:34:56.789-04:00", wantText: "[08:34]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timezone, func(t *testing.T) {
+			loc, err := ParseTimezone(tt.timezone)
+			if err != nil {
+				t.Fatalf("parse timezone: %v", err)
+			}
+
+			rendered, err := FormatJSON.Render(frame, loc)
+			if err != nil {
+				t.Fatalf("render json: %v", err)
+			}
+			decoded := model.MessageFrame{}
+			if err := json.Unmarshal(rendered, &decoded); err != nil {
+				t.Fatalf("json unmarshal: %v", err)
+			}
+			if decoded.Time != tt.wantTime {
+				t.Fatalf("got time %q, want %q", decoded.Time, tt.wantTime)
+			}
+			if decoded.Timestamp != frame.Timestamp {
+				t.Fatalf("got timestamp %d, want it unchanged %d", decoded.Timestamp, frame.Timestamp)
+			}
+
+			rendered, err = FormatText.Render(frame, loc)
+			if err != nil {
+				t.Fatalf("render text: %v", err)
+			}
+			if want := "1718022896789\t" + tt.wantText + "\tJim\thello\n"; string(rendered) != want {
+				t.Fatalf("got text %q, want %q", rendered, want)
+			}
+		})
+	}
+}
+
+func TestParseTimezoneUnknown(t *testing.T) {
+	if _, err := ParseTimezone("Mars/Olympus_Mons"); !errors.Is(err, ErrInvalidTimezone) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidTimezone)
+	}
+}
@@ -2,11 +2,11 @@ package core
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
-	"strings"
 	"time"
 
 	"github.com/dgdraganov/crispy-chat-service/internal/model"
@@ -16,106 +16,210 @@ var ErrInvalidIDFormat error = errors.New("client ID not in the correct format")
 var ErrInvalidSignature error = errors.New("client signature not valid")
 
 type chatService struct {
-	dSigner  DigitalSigner
-	dbClient DBClient
-	logger   *slog.Logger
+	signer    Signer
+	verifier  Verifier
+	dbClient  DBClient
+	idp       IdentityProvider
+	grants    GrantStore
+	limiter   RateLimiter
+	validator MessageValidator
+	hub       *hub
+	clock     Clock
+	logger    *slog.Logger
+
+	tokenConfig TokenConfig
+	aclConfig   ACLConfig
+
+	rateLimitConfig RateLimitConfig
+	publishConfig   PublishConfig
 }
 
-func New(ds DigitalSigner, dbClient DBClient, logger *slog.Logger) *chatService {
+// PublishConfig holds the settings of publishing
+type PublishConfig struct {
+	// DedupWindow is how long a client generated message ID is remembered, a
+	// message published again with the same ID within the window is not stored again
+	DedupWindow time.Duration
+}
+
+func New(signer Signer, verifier Verifier, dbClient DBClient, idp IdentityProvider, grants GrantStore, limiter RateLimiter, validator MessageValidator, clock Clock, hubConfig HubConfig, tokenConfig TokenConfig, aclConfig ACLConfig, rateLimitConfig RateLimitConfig, publishConfig PublishConfig, logger *slog.Logger) *chatService {
 	return &chatService{
-		dSigner:  ds,
-		dbClient: dbClient,
-		logger:   logger,
+		signer:      signer,
+		verifier:    verifier,
+		dbClient:    dbClient,
+		idp:         idp,
+		grants:      grants,
+		limiter:     limiter,
+		validator:   validator,
+		hub:         newHub(dbClient, hubConfig, logger),
+		clock:       clock,
+		logger:      logger,
+		tokenConfig: tokenConfig,
+		aclConfig:   aclConfig,
+
+		rateLimitConfig: rateLimitConfig,
+		publishConfig:   publishConfig,
 	}
 }
 
-// Sign will generate a digital signature from the clientID
-func (chat *chatService) Sign(clientID string) (string, error) {
-	if clientID == "" {
-		return "", fmt.Errorf("invalid client id: %w", ErrInvalidIDFormat)
-	}
+// Publish validates a message and saves it to the underlying db store and returns
+// the cursor of the stored message. The sentAt time is the optional time the client
+// sent the message, the zero time means unknown. The messageID is an optional client
+// generated ID, a message published again with the same ID within the dedup window
+// is not stored again and the cursor of the original message is returned.
+func (chat *chatService) Publish(ctx context.Context, clientID, room, messageID, message string, sentAt time.Time) (int64, error) {
+	requestID, _ := ctx.Value(model.RequestID).(string)
 
-	signature, err := chat.dSigner.Sign(clientID)
+	if err := validateMessageID(messageID); err != nil {
+		return 0, err
+	}
+	message, err := chat.validator.Validate(message)
 	if err != nil {
-		return "", fmt.Errorf("digital sign: %w", err)
+		return 0, err
 	}
-
-	return signature, nil
-}
-
-// Publish saves a message to the underlying db store
-func (chat *chatService) Publish(ctx context.Context, clientID, message string) error {
-	if message == "" {
-		return errors.New("message is empty")
+	if err := chat.CheckRoom(room); err != nil {
+		return 0, err
 	}
-	timestamp := time.Now().UTC().UnixMilli()
+	timestamp := toMillis(chat.clock.Now())
 	msgObj := model.ChatMessage{
 		Timestamp: timestamp,
+		SentAt:    toMillis(sentAt),
 		Message:   message,
 		ClientID:  clientID,
 	}
-	_, err := chat.dbClient.PublishMessage("common_room", float64(timestamp), msgObj)
+
+	if messageID == "" {
+		cursor, err := chat.dbClient.PublishMessage(room, float64(timestamp), msgObj)
+		if err != nil {
+			return 0, fmt.Errorf("db client publish message: %w", err)
+		}
+		return cursor, nil
+	}
+
+	cursor, duplicate, err := chat.dbClient.PublishUniqueMessage(room, dedupKey(clientID, messageID), chat.publishConfig.DedupWindow, float64(timestamp), msgObj)
 	if err != nil {
-		return fmt.Errorf("db client publish message: %w", err)
+		return 0, fmt.Errorf("db client publish unique message: %w", err)
 	}
+	if duplicate {
+		chat.logger.Info(
+			"duplicate message - not stored again",
+			"request_id", requestID,
+			"client_id", clientID,
+			"room", room,
+			"message_id", messageID,
+			"cursor", cursor,
+		)
+	}
+
+	return cursor, nil
+}
 
-	return nil
+// dedupKey returns the deduplication key of a message. The IDs are generated by
+// the clients, so they are only unique per client. The client ID is length
+// prefixed so that no two client and message ID pairs share a key, and the
+// result is hashed to keep the key short.
+func dedupKey(clientID, messageID string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", len(clientID), clientID, messageID)))
+	return hex.EncodeToString(sum[:])
 }
 
-// ReadMessages returns a channel that will receive new messages read from the underlying db store
-func (chat *chatService) ReadMessages(ctx context.Context, clientID string) chan string {
-	requestID := ctx.Value(model.RequestID).(string)
+// catchUpPageSize is the number of messages read from the db store at once
+// while a subscriber catches up with the hub backlog
+const catchUpPageSize = 500
+
+// ReadMessages returns a subscription that receives the messages stored after the
+// since cursor followed by the new messages. A since cursor of 0 reads the room
+// from the beginning. Messages older than the hub backlog are read from the db
+// store first. The subscription must be closed once it is no longer read, its
+// goroutines exit when it is closed or the context is cancelled.
+func (chat *chatService) ReadMessages(ctx context.Context, clientID, room string, since int64) (*Subscription, error) {
+	requestID, _ := ctx.Value(model.RequestID).(string)
+
+	if err := chat.CheckRoom(room); err != nil {
+		return nil, err
+	}
 
-	messagesChan := make(chan string)
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := newSubscription(cancel)
 
 	go func() {
-		messages, errors := chat.dbClient.ReadMessages(ctx, "common_room")
-		for {
-			select {
-			case msg, ok := <-messages:
-				if !ok {
-					return
-				}
-				msgObj := model.ChatMessage{}
-				err := json.Unmarshal([]byte(msg), &msgObj)
-				if err != nil {
-					chat.logger.Error(
-						"message unmarshal failed - discarding message",
-						"error", err,
-						"message_struct", msg,
-						"request_id", requestID,
-					)
-					continue
-				}
-				msgTime := time.Unix(msgObj.Timestamp, 0).Format("15:04")
-				chatMessage := fmt.Sprintf("[%s]\t%s\t%s\n", msgTime, msgObj.ClientID, msgObj.Message)
-				messagesChan <- chatMessage
-			case err, ok := <-errors:
-				if !ok {
-					return
-				}
+		// the error that stopped the stream, if any
+		var streamErr error
+		defer func() {
+			sub.finish(ctx, streamErr)
+		}()
+
+		send := func(msg model.StoredMessage) bool {
+			// the hub may hand out messages the subscriber already read from the db store
+			if msg.Cursor <= since {
+				return true
+			}
+			frame, err := newFrame(room, msg)
+			if err != nil {
 				chat.logger.Error(
-					"redis read messages",
+					"message unmarshal failed - discarding message",
 					"error", err,
+					"message_struct", msg.Message,
 					"request_id", requestID,
 				)
-				continue
+				return true
+			}
+			select {
+			case sub.messages <- frame:
+				since = msg.Cursor
+				return true
+			case <-subCtx.Done():
+				return false
 			}
 		}
-	}()
 
-	return messagesChan
-}
+		for {
+			hubSub, backlog, ok := chat.hub.subscribe(subCtx, room, since)
+			if ok {
+				defer chat.hub.unsubscribe(hubSub)
+				for _, msg := range backlog {
+					if !send(msg) {
+						return
+					}
+				}
+				for {
+					select {
+					case msg, ok := <-hubSub.messages:
+						if !ok || !send(msg) {
+							return
+						}
+					case <-subCtx.Done():
+						return
+					}
+				}
+			}
+			if subCtx.Err() != nil {
+				return
+			}
 
-// Verify checks the validity of a digital signature
-func (chat *chatService) Verify(signature, clientID string) (bool, error) {
-	if len(clientID) == 0 || strings.Contains(clientID, " ") {
-		return false, ErrInvalidIDFormat
-	}
+			chat.logger.Info(
+				"cursor is older than the hub backlog - reading from the db store",
+				"request_id", requestID,
+				"room", room,
+				"since", since,
+			)
+			messages, err := chat.dbClient.ReadRange(room, since, 0, catchUpPageSize, false)
+			if err != nil {
+				streamErr = fmt.Errorf("db client read range: %w", err)
+				return
+			}
+			if len(messages) == 0 {
+				streamErr = fmt.Errorf("no messages stored after cursor %d", since)
+				return
+			}
+			for _, msg := range messages {
+				if !send(msg) {
+					return
+				}
+				// a message that cannot be decoded is skipped as well
+				since = max(since, msg.Cursor)
+			}
+		}
+	}()
 
-	valid, err := chat.dSigner.Verify(signature, clientID)
-	if err != nil {
-		return false, fmt.Errorf("signature verify: %w", err)
-	}
-	return valid, nil
+	return sub, nil
 }
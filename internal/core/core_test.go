@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/memory"
+	"github.com/dgdraganov/crispy-chat-service/pkg/ratelimit"
+	"github.com/dgdraganov/crispy-chat-service/pkg/sign"
+)
+
+// fakeClock is a Clock that only moves when it is told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// staticIdentity identifies every client as the same identity
+type staticIdentity struct {
+	identity model.Identity
+}
+
+func (idp staticIdentity) Identify(ctx context.Context, credentials model.Credentials) (model.Identity, bool, error) {
+	return idp.identity, true, nil
+}
+
+// newTestChat returns a chat service on a memory store with the default room
+// and no rate limits, tokens are signed with an HMAC secret
+func newTestChat(t *testing.T, clock Clock, hubConfig HubConfig, tokenConfig TokenConfig) *chatService {
+	t.Helper()
+
+	signer, err := sign.NewHMAC(bytes.Repeat([]byte("k"), 32), sign.NewBase64Encoder())
+	if err != nil {
+		t.Fatalf("new hmac signer: %v", err)
+	}
+	store := memory.New()
+	chat := New(
+		signer,
+		signer,
+		store,
+		staticIdentity{identity: model.Identity{ClientID: "Jim"}},
+		store,
+		ratelimit.NewMemory(),
+		NewValidationChain(4096),
+		clock,
+		hubConfig,
+		tokenConfig,
+		ACLConfig{DefaultPermissions: []string{PermissionRoomRead, PermissionRoomWrite}},
+		RateLimitConfig{},
+		PublishConfig{DedupWindow: time.Minute},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err := chat.CreateRoom(DefaultRoom); err != nil {
+		t.Fatalf("create default room: %v", err)
+	}
+	return chat
+}
+
+func TestDedupKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a    [2]string
+		b    [2]string
+	}{
+		{name: "separator in client ID", a: [2]string{"a:b", "c"}, b: [2]string{"a", "b:c"}},
+		{name: "empty message ID", a: [2]string{"ab", ""}, b: [2]string{"a", "b"}},
+		{name: "swapped IDs", a: [2]string{"a", "b"}, b: [2]string{"b", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyA := dedupKey(tt.a[0], tt.a[1])
+			keyB := dedupKey(tt.b[0], tt.b[1])
+			if keyA == keyB {
+				t.Fatalf("%q and %q share the key %s", tt.a, tt.b, keyA)
+			}
+			if keyA != dedupKey(tt.a[0], tt.a[1]) {
+				t.Fatalf("key of %q is not stable", tt.a)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+var ErrInvalidFormat error = errors.New("unknown message format")
+
+// MessageFormat is the wire format of the messages sent to listening clients
+type MessageFormat string
+
+const (
+	// FormatText renders a message as "<cursor>\t[15:04]\t<client>\t<message>\n"
+	FormatText MessageFormat = "text"
+	// FormatJSON renders a message as a JSON encoded model.MessageFrame, its time
+	// field holds the server receive time in RFC 3339 format
+	FormatJSON MessageFormat = "json"
+)
+
+// ParseMessageFormat converts a query parameter to a MessageFormat, an empty value means text
+func ParseMessageFormat(format string) (MessageFormat, error) {
+	switch f := MessageFormat(format); f {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("format %q: %w", format, ErrInvalidFormat)
+	}
+}
+
+// Render encodes the frame in the given format with its times in the given location
+func (format MessageFormat) Render(frame model.MessageFrame, loc *time.Location) ([]byte, error) {
+	if format == FormatJSON {
+		b, err := json.Marshal(withTime(frame, loc))
+		if err != nil {
+			return nil, fmt.Errorf("json marshal: %w", err)
+		}
+		return b, nil
+	}
+
+	received := fromMillis(frame.Timestamp, loc)
+	return []byte(fmt.Sprintf("%d\t[%s]\t%s\t%s\n", frame.ID, received.Format("15:04"), frame.ClientID, frame.Message)), nil
+}
+
+// newFrame decodes a message read from the db store into a frame
+func newFrame(room string, msg model.StoredMessage) (model.MessageFrame, error) {
+	msgObj := model.ChatMessage{}
+	if err := json.Unmarshal([]byte(msg.Message), &msgObj); err != nil {
+		return model.MessageFrame{}, fmt.Errorf("json unmarshal: %w", err)
+	}
+
+	return model.MessageFrame{
+		ID:        msg.Cursor,
+		Type:      model.FrameTypeMessage,
+		Room:      room,
+		ClientID:  msgObj.ClientID,
+		Timestamp: msgObj.Timestamp,
+		SentAt:    msgObj.SentAt,
+		Message:   msgObj.Message,
+	}, nil
+}
+
+// withTime sets the frame's time field to the receive time in the given location
+func withTime(frame model.MessageFrame, loc *time.Location) model.MessageFrame {
+	frame.Time = fromMillis(frame.Timestamp, loc).Format(time.RFC3339Nano)
+	return frame
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+var ErrInvalidHistoryQuery error = errors.New("invalid history query")
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+)
+
+// History returns a page of up to limit stored messages with cursors between after
+// and before (both exclusive, 0 means unbounded). Without an after cursor the newest
+// messages of the range are returned, otherwise the oldest ones.
+func (chat *chatService) History(ctx context.Context, room string, after, before int64, limit int, loc *time.Location) (model.HistoryPage, error) {
+	requestID, _ := ctx.Value(model.RequestID).(string)
+
+	if limit == 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit < 0 || limit > MaxHistoryLimit {
+		return model.HistoryPage{}, fmt.Errorf("limit must be between 1 and %d: %w", MaxHistoryLimit, ErrInvalidHistoryQuery)
+	}
+	if after < 0 || before < 0 || (before > 0 && after >= before) {
+		return model.HistoryPage{}, fmt.Errorf("after must be less than before: %w", ErrInvalidHistoryQuery)
+	}
+	if err := chat.CheckRoom(room); err != nil {
+		return model.HistoryPage{}, err
+	}
+
+	newest := after == 0
+	messages, err := chat.dbClient.ReadRange(room, after, before, int64(limit), newest)
+	if err != nil {
+		return model.HistoryPage{}, fmt.Errorf("db client read range: %w", err)
+	}
+
+	page := model.HistoryPage{
+		Messages: make([]model.MessageFrame, 0, len(messages)),
+	}
+	for _, msg := range messages {
+		frame, err := newFrame(room, msg)
+		if err != nil {
+			chat.logger.Error(
+				"message unmarshal failed - discarding message",
+				"error", err,
+				"message_struct", msg.Message,
+				"request_id", requestID,
+			)
+			continue
+		}
+		page.Messages = append(page.Messages, withTime(frame, loc))
+	}
+	if len(messages) == 0 {
+		return page, nil
+	}
+
+	first, last := messages[0].Cursor, messages[len(messages)-1].Cursor
+
+	older, err := chat.dbClient.ReadRange(room, 0, first, 1, true)
+	if err != nil {
+		return model.HistoryPage{}, fmt.Errorf("db client read range: %w", err)
+	}
+	if len(older) > 0 {
+		page.Prev = first
+	}
+
+	newer, err := chat.dbClient.ReadRange(room, last, 0, 1, false)
+	if err != nil {
+		return model.HistoryPage{}, fmt.Errorf("db client read range: %w", err)
+	}
+	if len(newer) > 0 {
+		page.Next = last
+	}
+
+	return page, nil
+}
+
+// MaxHistoryWait is the longest time a history request waits for new messages
+const MaxHistoryWait = time.Minute
+
+// WaitMessages blocks until a message with a cursor greater than after is stored
+// in the room, the wait time passes or the context is cancelled. It returns true
+// when there is a new message.
+func (chat *chatService) WaitMessages(ctx context.Context, room string, after int64, wait time.Duration) (bool, error) {
+	if wait <= 0 || wait > MaxHistoryWait {
+		return false, fmt.Errorf("wait must be between 1ms and %s: %w", MaxHistoryWait, ErrInvalidHistoryQuery)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	clientID, _ := ctx.Value(model.ClientID).(string)
+	sub, err := chat.ReadMessages(waitCtx, clientID, room, after)
+	if err != nil {
+		return false, err
+	}
+	defer sub.Close()
+
+	_, ok := <-sub.Messages()
+	return ok, nil
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// SlowConsumerPolicy decides what the hub does with a subscriber whose buffer is full
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDrop discards the message for the slow subscriber only
+	PolicyDrop SlowConsumerPolicy = "drop"
+	// PolicyDisconnect unsubscribes the slow subscriber
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	// PolicyBlock waits for the slow subscriber, delaying the whole room
+	PolicyBlock SlowConsumerPolicy = "block"
+)
+
+// ParseSlowConsumerPolicy converts a config value to a SlowConsumerPolicy
+func ParseSlowConsumerPolicy(policy string) (SlowConsumerPolicy, error) {
+	switch p := SlowConsumerPolicy(policy); p {
+	case PolicyDrop, PolicyDisconnect, PolicyBlock:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown slow consumer policy %q", policy)
+	}
+}
+
+// HubConfig holds the settings of the broadcast hub
+type HubConfig struct {
+	// BufferSize is the number of messages buffered per subscriber
+	BufferSize int
+	// Policy is applied when a subscriber's buffer is full
+	Policy SlowConsumerPolicy
+	// BacklogSize is the number of messages kept in memory per room for new
+	// subscribers, 0 keeps all messages published since the room was opened
+	BacklogSize int
+}
+
+// hub keeps a single upstream reader per room and fans the messages out
+// to every local subscriber of that room
+type hub struct {
+	dbClient DBClient
+	config   HubConfig
+	logger   *slog.Logger
+
+	mu    sync.Mutex
+	rooms map[string]*roomHub
+}
+
+type roomHub struct {
+	room   string
+	cancel context.CancelFunc
+	// refs is the number of subscribers that have not unsubscribed yet, guarded by hub.mu
+	refs int
+	// ready is closed once the upstream reader knows where it starts
+	ready chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	backlog []model.StoredMessage
+	// trimmed is the cursor of the last message that is not in the backlog, the
+	// newest stored message when the room was opened or the last trimmed one
+	trimmed     int64
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	room     *roomHub
+	messages chan model.StoredMessage
+	ctx      context.Context
+	cancel   context.CancelFunc
+	once     sync.Once
+}
+
+func newHub(dbClient DBClient, config HubConfig, logger *slog.Logger) *hub {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1
+	}
+	if config.Policy == "" {
+		config.Policy = PolicyDrop
+	}
+	return &hub{
+		dbClient: dbClient,
+		config:   config,
+		logger:   logger,
+		rooms:    make(map[string]*roomHub),
+	}
+}
+
+// subscribe registers a new subscriber for the room and returns it together
+// with the messages after the since cursor that were read before it joined.
+// The subscriber's messages channel is closed when it is disconnected by the
+// hub. If the backlog does not hold all messages after the cursor no
+// subscriber is registered and false is returned, the older messages must be
+// read from the db store first.
+func (h *hub) subscribe(ctx context.Context, room string, since int64) (*subscriber, []model.StoredMessage, bool) {
+	h.mu.Lock()
+	rh, ok := h.rooms[room]
+	if !ok {
+		rh = h.openRoom(room)
+		h.rooms[room] = rh
+	}
+	rh.refs++
+	h.mu.Unlock()
+
+	select {
+	case <-rh.ready:
+	case <-ctx.Done():
+		h.release(rh)
+		return nil, nil, false
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &subscriber{
+		room:     rh,
+		messages: make(chan model.StoredMessage, h.config.BufferSize),
+		ctx:      subCtx,
+		cancel:   cancel,
+	}
+
+	rh.mu.Lock()
+	if rh.closed {
+		close(sub.messages)
+		rh.mu.Unlock()
+		return sub, nil, true
+	}
+	if since < rh.trimmed {
+		rh.mu.Unlock()
+		cancel()
+		h.release(rh)
+		return nil, nil, false
+	}
+	rh.subscribers[sub] = struct{}{}
+
+	start := sort.Search(len(rh.backlog), func(i int) bool {
+		return rh.backlog[i].Cursor > since
+	})
+	backlog := make([]model.StoredMessage, len(rh.backlog)-start)
+	copy(backlog, rh.backlog[start:])
+	rh.mu.Unlock()
+
+	return sub, backlog, true
+}
+
+// unsubscribe removes the subscriber from its room, the room's upstream
+// reader is stopped when its last subscriber leaves. It is safe to call
+// unsubscribe more than once.
+func (h *hub) unsubscribe(sub *subscriber) {
+	sub.once.Do(func() {
+		// cancel first so a blocked broadcast releases the room lock
+		sub.cancel()
+
+		rh := sub.room
+		rh.mu.Lock()
+		if _, ok := rh.subscribers[sub]; ok {
+			delete(rh.subscribers, sub)
+			close(sub.messages)
+		}
+		rh.mu.Unlock()
+
+		h.release(rh)
+	})
+}
+
+// release drops a reference to the room and stops its upstream reader when
+// nobody uses it anymore
+func (h *hub) release(rh *roomHub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rh.refs--
+	if rh.refs == 0 {
+		if h.rooms[rh.room] == rh {
+			delete(h.rooms, rh.room)
+		}
+		rh.cancel()
+	}
+}
+
+// openRoom starts the upstream reader of the room after its newest stored
+// message, must be called with h.mu held
+func (h *hub) openRoom(room string) *roomHub {
+	ctx, cancel := context.WithCancel(context.Background())
+	rh := &roomHub{
+		room:        room,
+		cancel:      cancel,
+		ready:       make(chan struct{}),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+
+	go func() {
+		defer h.closeRoom(rh)
+
+		newest, err := h.dbClient.ReadRange(room, 0, 0, 1, true)
+		if err != nil {
+			h.logger.Error(
+				"hub read newest message",
+				"error", err,
+				"room", room,
+			)
+			return
+		}
+		if len(newest) > 0 {
+			rh.trimmed = newest[0].Cursor
+		}
+		close(rh.ready)
+
+		messages, errors := h.dbClient.ReadMessages(ctx, room, rh.trimmed)
+
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				h.broadcast(rh, msg)
+			case err, ok := <-errors:
+				if !ok {
+					return
+				}
+				h.logger.Error(
+					"hub read messages",
+					"error", err,
+					"room", room,
+				)
+			}
+		}
+	}()
+
+	return rh
+}
+
+// closeRoom disconnects all subscribers once the upstream reader has stopped
+func (h *hub) closeRoom(rh *roomHub) {
+	h.mu.Lock()
+	if h.rooms[rh.room] == rh {
+		delete(h.rooms, rh.room)
+	}
+	h.mu.Unlock()
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	select {
+	case <-rh.ready:
+	default:
+		// the upstream reader failed to start
+		close(rh.ready)
+	}
+	rh.closed = true
+	for sub := range rh.subscribers {
+		delete(rh.subscribers, sub)
+		close(sub.messages)
+	}
+	rh.backlog = nil
+}
+
+// broadcast stores the message in the room's backlog and hands it to every subscriber
+func (h *hub) broadcast(rh *roomHub, msg model.StoredMessage) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	rh.backlog = append(rh.backlog, msg)
+	if h.config.BacklogSize > 0 && len(rh.backlog) > h.config.BacklogSize {
+		trim := len(rh.backlog) - h.config.BacklogSize
+		rh.trimmed = rh.backlog[trim-1].Cursor
+		rh.backlog = rh.backlog[trim:]
+	}
+
+	for sub := range rh.subscribers {
+		if h.config.Policy == PolicyBlock {
+			select {
+			case sub.messages <- msg:
+			case <-sub.ctx.Done():
+			}
+			continue
+		}
+
+		select {
+		case sub.messages <- msg:
+			continue
+		default:
+		}
+
+		if h.config.Policy == PolicyDisconnect {
+			h.logger.Warn(
+				"slow subscriber disconnected",
+				"room", rh.room,
+			)
+			delete(rh.subscribers, sub)
+			close(sub.messages)
+			continue
+		}
+
+		h.logger.Warn(
+			"slow subscriber - message dropped",
+			"room", rh.room,
+		)
+	}
+}
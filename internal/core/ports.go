@@ -1,12 +1,64 @@
 package core
 
-import "context"
+import (
+	"context"
+	"time"
 
-type DigitalSigner interface {
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type Signer interface {
 	Sign(message string) (string, error)
+}
+type Verifier interface {
 	Verify(signature, message string) (bool, error)
 }
 type DBClient interface {
 	PublishMessage(room string, sortKey float64, message any) (int64, error)
-	ReadMessages(ctx context.Context, room string) (<-chan string, <-chan error)
+	// PublishUniqueMessage saves the message unless a message with the same key was
+	// published to the room within the window. It returns the cursor of the stored
+	// message and true when the message is a duplicate and was not saved again.
+	PublishUniqueMessage(room, key string, window time.Duration, sortKey float64, message any) (int64, bool, error)
+	// ReadMessages sends the messages stored in the room after the since cursor
+	// and then every new message. The stream goes on after most errors, both
+	// channels are closed once the context is cancelled or the stream cannot go on.
+	ReadMessages(ctx context.Context, room string, since int64) (<-chan model.StoredMessage, <-chan error)
+	// ReadRange reads up to limit messages between the after and before cursors,
+	// a limit of 0 or less returns no messages
+	ReadRange(room string, after, before int64, limit int64, newest bool) ([]model.StoredMessage, error)
+	CreateRoom(room string) (bool, error)
+	DeleteRoom(room string) (bool, error)
+	ListRooms() ([]string, error)
+	RoomExists(room string) (bool, error)
+}
+
+// IdentityProvider verifies the credentials a client presents to obtain a token.
+// It returns false when the credentials are rejected.
+type IdentityProvider interface {
+	Identify(ctx context.Context, credentials model.Credentials) (model.Identity, bool, error)
+}
+
+// GrantStore provides the permissions granted in each room
+type GrantStore interface {
+	Grants(room string) ([]model.Grant, error)
+}
+
+// GrantWriter is implemented by grant stores whose grants can be changed through the service
+type GrantWriter interface {
+	SetGrant(room string, grant model.Grant) error
+	DeleteGrant(room, clientID string) (bool, error)
+}
+
+// RateLimiter keeps a token bucket per key
+type RateLimiter interface {
+	// Allow takes a token from every bucket, or from none of them when one of
+	// the buckets is empty. It returns -1 when the tokens were taken, otherwise
+	// the index of the first empty bucket and the time until it has a token.
+	Allow(buckets []model.RateLimitBucket) (int, time.Duration, error)
+}
+
+// MessageValidator checks a message before it is published. It returns the
+// message to publish, which may be sanitized, or a ValidationError.
+type MessageValidator interface {
+	Validate(message string) (string, error)
 }
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+var ErrRateLimited error = errors.New("rate limit exceeded")
+var ErrInvalidRateLimit error = errors.New("rate limit not valid")
+
+// RateLimitError is returned when a publish exceeds one of the rate limits
+type RateLimitError struct {
+	// Scope is the exceeded limit - "ip", "client" or "room"
+	Scope string
+	// RetryAfter is the time until the limit allows the next message
+	RetryAfter time.Duration
+}
+
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("%s %s, retry after %s", err.Scope, ErrRateLimited, err.RetryAfter)
+}
+
+func (err *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// Violation reports whether the client is to blame for the rejection. The room
+// limit is shared by everyone publishing to the room, so exceeding it is not.
+func (err *RateLimitError) Violation() bool {
+	return err.Scope != "room"
+}
+
+// RateLimitConfig holds the publish rate limits, a zero limit is disabled
+type RateLimitConfig struct {
+	// Client limits the messages of each client across all rooms and connections
+	Client model.RateLimit
+	// Room limits the messages published to each room
+	Room model.RateLimit
+	// IP limits the messages published from each remote address
+	IP model.RateLimit
+}
+
+// ParseRateLimit converts a config value like "10/1s" - 10 messages per second
+// with bursts of up to 10 messages - to a rate limit. An empty value disables the limit.
+func ParseRateLimit(limit string) (model.RateLimit, error) {
+	if limit == "" {
+		return model.RateLimit{}, nil
+	}
+
+	count, interval, found := strings.Cut(limit, "/")
+	if !found {
+		return model.RateLimit{}, fmt.Errorf("%q: %w", limit, ErrInvalidRateLimit)
+	}
+	tokens, err := strconv.Atoi(count)
+	if err != nil || tokens <= 0 {
+		return model.RateLimit{}, fmt.Errorf("%q: %w", limit, ErrInvalidRateLimit)
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil || duration <= 0 {
+		return model.RateLimit{}, fmt.Errorf("%q: %w", limit, ErrInvalidRateLimit)
+	}
+
+	return model.RateLimit{Tokens: tokens, Interval: duration}, nil
+}
+
+// CheckRateLimit takes a token from the buckets of the remote address, the
+// client and the room and returns a RateLimitError if one of them is empty. A
+// rejected message takes no tokens, so it does not count against the limits
+// that allowed it.
+func (chat *chatService) CheckRateLimit(clientID, room, ip string) error {
+	checks := []struct {
+		scope string
+		key   string
+		limit model.RateLimit
+	}{
+		{scope: "ip", key: "ip:" + ip, limit: chat.rateLimitConfig.IP},
+		{scope: "client", key: "client:" + clientID, limit: chat.rateLimitConfig.Client},
+		{scope: "room", key: "room:" + room, limit: chat.rateLimitConfig.Room},
+	}
+
+	scopes := make([]string, 0, len(checks))
+	buckets := make([]model.RateLimitBucket, 0, len(checks))
+	for _, check := range checks {
+		if check.limit.Disabled() || (check.scope == "ip" && ip == "") {
+			continue
+		}
+		scopes = append(scopes, check.scope)
+		buckets = append(buckets, model.RateLimitBucket{Key: check.key, Limit: check.limit})
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	empty, retryAfter, err := chat.limiter.Allow(buckets)
+	if err != nil {
+		return fmt.Errorf("rate limiter allow: %w", err)
+	}
+	if empty >= 0 {
+		return &RateLimitError{
+			Scope:      scopes[empty],
+			RetryAfter: retryAfter,
+		}
+	}
+
+	return nil
+}
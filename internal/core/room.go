@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// DefaultRoom is used whenever a client does not specify a room
+const DefaultRoom = "common_room"
+
+var ErrInvalidRoomName error = errors.New("room name not in the correct format")
+var ErrRoomNotFound error = errors.New("room not found")
+var ErrRoomExists error = errors.New("room already exists")
+var ErrDefaultRoom error = errors.New("default room cannot be deleted")
+
+var roomNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidateRoom checks that the room name contains only letters, digits, '_' and '-'
+// and is no longer than 64 characters
+func ValidateRoom(room string) error {
+	if !roomNameRegex.MatchString(room) {
+		return fmt.Errorf("room %q: %w", room, ErrInvalidRoomName)
+	}
+	return nil
+}
+
+// CreateRoom registers a new room in the underlying db store
+func (chat *chatService) CreateRoom(room string) error {
+	if err := ValidateRoom(room); err != nil {
+		return err
+	}
+
+	created, err := chat.dbClient.CreateRoom(room)
+	if err != nil {
+		return fmt.Errorf("db client create room: %w", err)
+	}
+	if !created {
+		return fmt.Errorf("room %q: %w", room, ErrRoomExists)
+	}
+
+	return nil
+}
+
+// ListRooms returns the names of all registered rooms
+func (chat *chatService) ListRooms() ([]string, error) {
+	rooms, err := chat.dbClient.ListRooms()
+	if err != nil {
+		return nil, fmt.Errorf("db client list rooms: %w", err)
+	}
+	return rooms, nil
+}
+
+// DeleteRoom removes a room and all of its messages from the underlying db store
+func (chat *chatService) DeleteRoom(room string) error {
+	if err := ValidateRoom(room); err != nil {
+		return err
+	}
+	if room == DefaultRoom {
+		return ErrDefaultRoom
+	}
+
+	deleted, err := chat.dbClient.DeleteRoom(room)
+	if err != nil {
+		return fmt.Errorf("db client delete room: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("room %q: %w", room, ErrRoomNotFound)
+	}
+
+	return nil
+}
+
+// CheckRoom validates the room name and makes sure the room exists
+func (chat *chatService) CheckRoom(room string) error {
+	if err := ValidateRoom(room); err != nil {
+		return err
+	}
+
+	exists, err := chat.dbClient.RoomExists(room)
+	if err != nil {
+		return fmt.Errorf("db client room exists: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("room %q: %w", room, ErrRoomNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// ErrStreamClosed is returned by Subscription.Err when the server stopped the
+// message stream, e.g. a slow subscriber was disconnected
+var ErrStreamClosed error = errors.New("message stream closed")
+
+// Subscription delivers the messages of a room read by ReadMessages until it
+// is closed, its context is cancelled or the server stops the message stream
+type Subscription struct {
+	messages chan model.MessageFrame
+	cancel   context.CancelFunc
+	// done is closed once the goroutines of the subscription have exited
+	done chan struct{}
+
+	// mu guards closed and err
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+func newSubscription(cancel context.CancelFunc) *Subscription {
+	return &Subscription{
+		messages: make(chan model.MessageFrame),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+}
+
+// Messages returns the channel of the messages, it is closed when the subscription stops
+func (sub *Subscription) Messages() <-chan model.MessageFrame {
+	return sub.messages
+}
+
+// Close stops the subscription and waits for its goroutines to exit. It is
+// safe to call Close more than once and while reading the messages.
+func (sub *Subscription) Close() {
+	sub.mu.Lock()
+	sub.closed = true
+	sub.mu.Unlock()
+
+	sub.cancel()
+	<-sub.done
+}
+
+// Err returns why the subscription stopped once the messages channel is
+// closed: nil after Close, the context error after the context was cancelled
+// or an error wrapping ErrStreamClosed when the server stopped the stream
+func (sub *Subscription) Err() error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	return sub.err
+}
+
+// finish records the reason the subscription stopped and closes its channels,
+// streamErr is the last error of the message stream if any
+func (sub *Subscription) finish(ctx context.Context, streamErr error) {
+	sub.mu.Lock()
+	switch {
+	case sub.closed:
+	case ctx.Err() != nil:
+		sub.err = ctx.Err()
+	case streamErr != nil:
+		sub.err = fmt.Errorf("%w: %w", ErrStreamClosed, streamErr)
+	default:
+		sub.err = ErrStreamClosed
+	}
+	sub.mu.Unlock()
+
+	close(sub.messages)
+	close(sub.done)
+	sub.cancel()
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// waitGoroutines fails the test unless the number of goroutines drops back to
+// the baseline, the goroutines of a closed subscription exit asynchronously
+func waitGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("%d goroutines left, want at most %d:\n%s", runtime.NumGoroutine(), baseline, buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitClosed reads the subscription until its messages channel is closed
+func waitClosed(t *testing.T, sub *Subscription) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-sub.Messages():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("messages channel not closed\n%s", buf[:n])
+		}
+	}
+}
+
+// waitSubscribers waits until the hub has the given number of subscribers in the room
+func waitSubscribers(t *testing.T, chat *chatService, room string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		chat.hub.mu.Lock()
+		rh := chat.hub.rooms[room]
+		chat.hub.mu.Unlock()
+
+		subscribers := 0
+		if rh != nil {
+			rh.mu.Lock()
+			subscribers = len(rh.subscribers)
+			rh.mu.Unlock()
+		}
+		if subscribers == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d subscribers in room %s, want %d", subscribers, room, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func publish(t *testing.T, chat *chatService, message string) {
+	t.Helper()
+
+	if _, err := chat.Publish(context.Background(), "Jim", DefaultRoom, "", message, time.Time{}); err != nil {
+		t.Fatalf("publish %q: %v", message, err)
+	}
+}
+
+func TestSubscriptionStops(t *testing.T) {
+	tests := []struct {
+		name      string
+		hubConfig HubConfig
+		// stop ends the subscription after a message was read
+		stop    func(t *testing.T, chat *chatService, sub *Subscription, cancel context.CancelFunc)
+		wantErr func(err error) bool
+	}{
+		{
+			name:      "closed",
+			hubConfig: HubConfig{BufferSize: 16},
+			stop: func(t *testing.T, chat *chatService, sub *Subscription, cancel context.CancelFunc) {
+				sub.Close()
+			},
+			wantErr: func(err error) bool { return err == nil },
+		},
+		{
+			name:      "context cancelled",
+			hubConfig: HubConfig{BufferSize: 16},
+			stop: func(t *testing.T, chat *chatService, sub *Subscription, cancel context.CancelFunc) {
+				cancel()
+			},
+			wantErr: func(err error) bool { return errors.Is(err, context.Canceled) },
+		},
+		{
+			name:      "slow consumer disconnected",
+			hubConfig: HubConfig{BufferSize: 1, Policy: PolicyDisconnect},
+			stop: func(t *testing.T, chat *chatService, sub *Subscription, cancel context.CancelFunc) {
+				// the first message may have been read from the db store before
+				// the subscription joined the hub
+				waitSubscribers(t, chat, DefaultRoom, 1)
+
+				// nobody reads the subscription, so its hub buffer overflows
+				for i := 0; i < 5; i++ {
+					publish(t, chat, "flood")
+				}
+				waitSubscribers(t, chat, DefaultRoom, 0)
+			},
+			wantErr: func(err error) bool { return errors.Is(err, ErrStreamClosed) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+
+			chat := newTestChat(t, NewSystemClock(), tt.hubConfig, TokenConfig{})
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), model.RequestID, "test"))
+			defer cancel()
+
+			sub, err := chat.ReadMessages(ctx, "Jim", DefaultRoom, 0)
+			if err != nil {
+				t.Fatalf("read messages: %v", err)
+			}
+
+			publish(t, chat, "hello")
+			select {
+			case frame := <-sub.Messages():
+				if frame.Message != "hello" {
+					t.Fatalf("got message %q, want %q", frame.Message, "hello")
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("published message not received")
+			}
+
+			tt.stop(t, chat, sub, cancel)
+			waitClosed(t, sub)
+			if err := sub.Err(); !tt.wantErr(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			// closing a stopped subscription is safe and waits for nothing
+			sub.Close()
+			waitGoroutines(t, baseline)
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+var ErrInvalidToken error = errors.New("token not valid")
+var ErrTokenExpired error = errors.New("token expired")
+var ErrInsufficientScope error = errors.New("token scope not sufficient")
+var ErrInvalidCredentials error = errors.New("client credentials not valid")
+var ErrTokenIssuingDisabled error = errors.New("token issuing disabled")
+
+const (
+	ScopeRead       = "chat:read"
+	ScopeWrite      = "chat:write"
+	ScopeRoomsAdmin = "rooms:admin"
+)
+
+// DefaultIdentityScopes are the scopes of clients whose identity provider did not
+// name any, rooms:admin is only granted to identities that carry it explicitly
+var DefaultIdentityScopes = []string{ScopeRead, ScopeWrite}
+
+// clockSkew is the tolerance for tokens issued by a server whose clock is slightly ahead
+const clockSkew = time.Second * 30
+
+// TokenConfig holds the settings of the issued tokens
+type TokenConfig struct {
+	// TTL is how long a token is valid after it is issued
+	TTL time.Duration
+	// Audience is put in every issued token and required from every verified one
+	Audience string
+	// Scopes are the scopes a client may request, all of them that the client's
+	// identity allows are granted when none are requested
+	Scopes []string
+	// RefreshWindow is how long after its expiry a token can still be refreshed
+	RefreshWindow time.Duration
+	// MaxAge is how long after the client authenticated with its credentials
+	// its tokens can be refreshed, tokens never expire later. Zero disables the limit.
+	MaxAge time.Duration
+}
+
+// IssueToken verifies the client credentials with the identity provider and generates
+// a signed token for the identified client with the requested scopes. The scopes
+// granted are limited to the configured ones and to the ones of the identity,
+// DefaultIdentityScopes when the provider named none. A service without a signer
+// only verifies tokens and returns ErrTokenIssuingDisabled.
+func (chat *chatService) IssueToken(ctx context.Context, credentials model.Credentials, scopes []string) (model.AuthResponse, error) {
+	if chat.signer == nil {
+		return model.AuthResponse{}, ErrTokenIssuingDisabled
+	}
+	if credentials.ClientID != "" {
+		if err := validateClientID(credentials.ClientID); err != nil {
+			return model.AuthResponse{}, fmt.Errorf("invalid client id: %w", err)
+		}
+	}
+
+	identity, ok, err := chat.idp.Identify(ctx, credentials)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("identity provider identify: %w", err)
+	}
+	if !ok {
+		return model.AuthResponse{}, ErrInvalidCredentials
+	}
+	if err := validateClientID(identity.ClientID); err != nil {
+		return model.AuthResponse{}, fmt.Errorf("identified client id: %w", err)
+	}
+
+	identityScopes := identity.Scopes
+	if len(identityScopes) == 0 {
+		identityScopes = DefaultIdentityScopes
+	}
+	allowed := []string{}
+	for _, scope := range chat.tokenConfig.Scopes {
+		if slices.Contains(identityScopes, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return model.AuthResponse{}, fmt.Errorf("scope %q: %w", scope, ErrInsufficientScope)
+		}
+	}
+
+	return chat.issue(identity.ClientID, scopes, chat.clock.Now())
+}
+
+// RefreshToken issues a new token with the same subject and scopes as the given one. The
+// given token must be valid or expired no longer than the configured refresh window ago.
+// Since the credentials are not checked again, the client must authenticate anew
+// once the configured max age has passed since it last did.
+func (chat *chatService) RefreshToken(token string) (model.AuthResponse, error) {
+	if chat.signer == nil {
+		return model.AuthResponse{}, ErrTokenIssuingDisabled
+	}
+	claims, err := chat.parseToken(token)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	expiry := time.Unix(claims.ExpiresAt, 0)
+	if chat.clock.Now().After(expiry.Add(chat.tokenConfig.RefreshWindow)) {
+		return model.AuthResponse{}, ErrTokenExpired
+	}
+
+	// without the time the client authenticated the max age cannot be enforced
+	if claims.AuthTime == 0 {
+		return model.AuthResponse{}, fmt.Errorf("missing auth_time: %w", ErrInvalidToken)
+	}
+	authTime := time.Unix(claims.AuthTime, 0)
+	if chat.tokenConfig.MaxAge > 0 && !chat.clock.Now().Before(authTime.Add(chat.tokenConfig.MaxAge)) {
+		return model.AuthResponse{}, fmt.Errorf("authenticated more than %s ago: %w", chat.tokenConfig.MaxAge, ErrTokenExpired)
+	}
+
+	return chat.issue(claims.Subject, claims.Scopes, authTime)
+}
+
+// Authenticate verifies that the token is valid and not expired and returns
+// the principal it was issued to
+func (chat *chatService) Authenticate(token string) (model.Principal, error) {
+	claims, err := chat.parseToken(token)
+	if err != nil {
+		return model.Principal{}, err
+	}
+
+	now := chat.clock.Now()
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return model.Principal{}, ErrTokenExpired
+	}
+	if now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return model.Principal{}, fmt.Errorf("issued in the future: %w", ErrInvalidToken)
+	}
+	if err := validateClientID(claims.Subject); err != nil {
+		return model.Principal{}, fmt.Errorf("subject: %w", ErrInvalidToken)
+	}
+
+	return model.Principal{
+		ClientID:  claims.Subject,
+		Scopes:    claims.Scopes,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+// issue signs a token for the client that authenticated with its credentials at authTime
+func (chat *chatService) issue(clientID string, scopes []string, authTime time.Time) (model.AuthResponse, error) {
+	now := chat.clock.Now()
+	expiry := now.Add(chat.tokenConfig.TTL)
+	if maxExpiry := authTime.Add(chat.tokenConfig.MaxAge); chat.tokenConfig.MaxAge > 0 && expiry.After(maxExpiry) {
+		expiry = maxExpiry
+	}
+	claims := model.TokenClaims{
+		Subject:   clientID,
+		Audience:  chat.tokenConfig.Audience,
+		Scopes:    scopes,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiry.Unix(),
+		AuthTime:  authTime.Unix(),
+	}
+
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("json marshal: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claimsBytes)
+
+	signature, err := chat.signer.Sign(payload)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("digital sign: %w", err)
+	}
+
+	return model.AuthResponse{
+		Token:     payload + "." + signature,
+		ExpiresAt: claims.ExpiresAt,
+		Scopes:    claims.Scopes,
+	}, nil
+}
+
+// parseToken verifies the token signature and audience and returns its claims,
+// the expiry is checked by the callers
+func (chat *chatService) parseToken(token string) (model.TokenClaims, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return model.TokenClaims{}, fmt.Errorf("malformed token: %w", ErrInvalidToken)
+	}
+
+	valid, err := chat.verifier.Verify(signature, payload)
+	if err != nil {
+		return model.TokenClaims{}, fmt.Errorf("signature verify: %w: %v", ErrInvalidToken, err)
+	}
+	if !valid {
+		return model.TokenClaims{}, fmt.Errorf("invalid signature: %w", ErrInvalidToken)
+	}
+
+	claimsBytes, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return model.TokenClaims{}, fmt.Errorf("base64 decode claims: %w", ErrInvalidToken)
+	}
+	claims := model.TokenClaims{}
+	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+		return model.TokenClaims{}, fmt.Errorf("json unmarshal claims: %w", ErrInvalidToken)
+	}
+
+	if claims.Audience != chat.tokenConfig.Audience {
+		return model.TokenClaims{}, fmt.Errorf("audience %q: %w", claims.Audience, ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// validateClientID checks that the client ID is not empty and contains no spaces
+func validateClientID(clientID string) error {
+	if len(clientID) == 0 || strings.Contains(clientID, " ") {
+		return ErrInvalidIDFormat
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+func TestRefreshTokenMaxAge(t *testing.T) {
+	authTime := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	clock := newFakeClock(authTime)
+	chat := newTestChat(t, clock, HubConfig{}, TokenConfig{
+		TTL:           time.Hour,
+		Audience:      "crispy-chat",
+		Scopes:        []string{ScopeRead, ScopeWrite},
+		RefreshWindow: time.Hour,
+		MaxAge:        2 * time.Hour,
+	})
+
+	issued, err := chat.IssueToken(context.Background(), model.Credentials{Secret: "k1"}, nil)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	steps := []struct {
+		name       string
+		at         time.Duration
+		wantExpiry time.Duration
+		wantErr    error
+	}{
+		{name: "within the ttl", at: 50 * time.Minute, wantExpiry: 110 * time.Minute},
+		{name: "expiry capped at the max age", at: 100 * time.Minute, wantExpiry: 2 * time.Hour},
+		{name: "past the max age", at: 2 * time.Hour, wantErr: ErrTokenExpired},
+	}
+
+	token := issued.Token
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			clock.Set(authTime.Add(step.at))
+
+			refreshed, err := chat.RefreshToken(token)
+			if step.wantErr != nil {
+				if !errors.Is(err, step.wantErr) {
+					t.Fatalf("got error %v, want %v", err, step.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("refresh token: %v", err)
+			}
+			if want := authTime.Add(step.wantExpiry).Unix(); refreshed.ExpiresAt != want {
+				t.Fatalf("got expiry %d, want %d", refreshed.ExpiresAt, want)
+			}
+
+			claims, err := chat.parseToken(refreshed.Token)
+			if err != nil {
+				t.Fatalf("parse refreshed token: %v", err)
+			}
+			if claims.AuthTime != authTime.Unix() {
+				t.Fatalf("got auth time %d, want %d", claims.AuthTime, authTime.Unix())
+			}
+			token = refreshed.Token
+		})
+	}
+}
+
+func TestRefreshTokenWithoutAuthTime(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	chat := newTestChat(t, newFakeClock(now), HubConfig{}, TokenConfig{
+		TTL:           time.Hour,
+		Audience:      "crispy-chat",
+		RefreshWindow: time.Hour,
+		MaxAge:        2 * time.Hour,
+	})
+
+	claims, err := json.Marshal(model.TokenClaims{
+		Subject:   "Jim",
+		Audience:  "crispy-chat",
+		Scopes:    []string{ScopeRead},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("json marshal: %v", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	signature, err := chat.signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, err := chat.RefreshToken(payload + "." + signature); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+// failingVerifier fails every verification, e.g. like a verifier whose key set cannot be fetched
+type failingVerifier struct {
+	err error
+}
+
+func (v failingVerifier) Verify(signature, message string) (bool, error) {
+	return false, v.err
+}
+
+func TestParseTokenKeepsVerifierError(t *testing.T) {
+	chat := newTestChat(t, NewSystemClock(), HubConfig{}, TokenConfig{Audience: "crispy-chat"})
+	chat.verifier = failingVerifier{err: errors.New("fetch key set: connection refused")}
+
+	_, err := chat.parseToken("payload.signature")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidToken)
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("verifier error missing from %q", err)
+	}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrInvalidMessage error = errors.New("message not valid")
+
+const (
+	ValidationEmptyMessage    = "empty_message"
+	ValidationMessageTooLarge = "message_too_large"
+	ValidationInvalidUTF8     = "invalid_utf8"
+	ValidationInvalidID       = "invalid_message_id"
+)
+
+// maxMessageIDLength is the length in bytes of the longest client generated message ID
+const maxMessageIDLength = 128
+
+// ValidationError is returned when a message is rejected by one of the validators
+type ValidationError struct {
+	// Code identifies the failed check, e.g. "message_too_large"
+	Code string
+	// Reason describes the failed check to the client
+	Reason string
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidMessage, err.Reason)
+}
+
+func (err *ValidationError) Unwrap() error {
+	return ErrInvalidMessage
+}
+
+// validateMessageID checks the client generated message ID, an empty ID is valid
+func validateMessageID(messageID string) error {
+	if len(messageID) > maxMessageIDLength || !utf8.ValidString(messageID) {
+		return &ValidationError{
+			Code:   ValidationInvalidID,
+			Reason: fmt.Sprintf("message ID is not valid UTF-8 of up to %d bytes", maxMessageIDLength),
+		}
+	}
+	return nil
+}
+
+// ValidatorFunc adapts a function to the MessageValidator interface
+type ValidatorFunc func(message string) (string, error)
+
+// Validate calls the function
+func (f ValidatorFunc) Validate(message string) (string, error) {
+	return f(message)
+}
+
+// ValidationChain runs the validators in order, every validator gets the
+// message as returned by the previous one
+type ValidationChain []MessageValidator
+
+// Validate implements the MessageValidator interface for the ValidationChain type
+func (chain ValidationChain) Validate(message string) (string, error) {
+	var err error
+	for _, validator := range chain {
+		message, err = validator.Validate(message)
+		if err != nil {
+			return "", err
+		}
+	}
+	return message, nil
+}
+
+// NewValidationChain returns the default validators - the message must be valid
+// UTF-8, control characters are stripped and the rest must be between 1 and
+// maxSize bytes long. A maxSize of 0 does not limit the size.
+func NewValidationChain(maxSize int) ValidationChain {
+	chain := ValidationChain{
+		ValidUTF8(),
+		StripControlCharacters(),
+		NotEmpty(),
+	}
+	if maxSize > 0 {
+		chain = append(chain, MaxSize(maxSize))
+	}
+	return chain
+}
+
+// ValidUTF8 rejects messages that are not valid UTF-8
+func ValidUTF8() ValidatorFunc {
+	return func(message string) (string, error) {
+		if !utf8.ValidString(message) {
+			return "", &ValidationError{
+				Code:   ValidationInvalidUTF8,
+				Reason: "message is not valid UTF-8",
+			}
+		}
+		return message, nil
+	}
+}
+
+// StripControlCharacters removes the control characters from the message
+// except for new lines and tabs
+func StripControlCharacters() ValidatorFunc {
+	return func(message string) (string, error) {
+		return strings.Map(func(r rune) rune {
+			if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+				return r
+			}
+			return -1
+		}, message), nil
+	}
+}
+
+// NotEmpty rejects empty and blank messages
+func NotEmpty() ValidatorFunc {
+	return func(message string) (string, error) {
+		if strings.TrimSpace(message) == "" {
+			return "", &ValidationError{
+				Code:   ValidationEmptyMessage,
+				Reason: "message is empty",
+			}
+		}
+		return message, nil
+	}
+}
+
+// MaxSize rejects messages longer than maxSize bytes
+func MaxSize(maxSize int) ValidatorFunc {
+	return func(message string) (string, error) {
+		if len(message) > maxSize {
+			return "", &ValidationError{
+				Code:   ValidationMessageTooLarge,
+				Reason: fmt.Sprintf("message is longer than %d bytes", maxSize),
+			}
+		}
+		return message, nil
+	}
+}
@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	chatv1 "github.com/dgdraganov/crispy-chat-service/api/chat/v1"
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type chatServer struct {
+	chatv1.UnimplementedChatServiceServer
+
+	chat   Chat
+	logger *slog.Logger
+}
+
+// NewChatServer is a constructor function for the chatServer type
+func NewChatServer(chat Chat, logger *slog.Logger) *chatServer {
+	return &chatServer{
+		chat:   chat,
+		logger: logger,
+	}
+}
+
+// Auth implements the ChatService Auth RPC
+func (s *chatServer) Auth(ctx context.Context, req *chatv1.AuthRequest) (*chatv1.AuthResponse, error) {
+	credentials := model.Credentials{
+		ClientID: req.GetClientId(),
+		Secret:   req.GetSecret(),
+	}
+	resp, err := s.chat.IssueToken(ctx, credentials, req.GetScopes())
+	if err != nil {
+		return nil, s.statusError(ctx, "issue token", err)
+	}
+
+	return &chatv1.AuthResponse{
+		Token:     resp.Token,
+		ExpiresAt: resp.ExpiresAt,
+		Scopes:    resp.Scopes,
+	}, nil
+}
+
+// Publish implements the ChatService Publish RPC
+func (s *chatServer) Publish(ctx context.Context, req *chatv1.PublishRequest) (*chatv1.PublishResponse, error) {
+	return s.publish(ctx, req)
+}
+
+// PublishStream implements the ChatService PublishStream RPC
+func (s *chatServer) PublishStream(stream chatv1.ChatService_PublishStreamServer) error {
+	ctx := stream.Context()
+	requestID, _ := ctx.Value(model.RequestID).(string)
+	principal := ctx.Value(model.PrincipalKey).(model.Principal)
+
+	expiry := common.ExpiryTimer(principal.ExpiresAt)
+	defer expiry.Stop()
+
+	// the requests are received in the background so that the stream can be
+	// ended when the token expires, returning cancels the stream context
+	// which stops the receiving
+	requests := make(chan *chatv1.PublishRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var req *chatv1.PublishRequest
+		select {
+		case req = <-requests:
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case <-expiry.C:
+			s.logger.Info(
+				"closing publish stream of expired token",
+				"request_id", requestID,
+				"client_id", principal.ClientID,
+			)
+			return status.Error(codes.Unauthenticated, "token expired")
+		}
+
+		// a message that cannot be published does not end the stream, the
+		// client learns from its result which messages have to be sent again
+		if err := stream.Send(s.publishResult(ctx, req)); err != nil {
+			return err
+		}
+	}
+}
+
+// publishResult publishes the message and returns its cursor or the status of the error
+func (s *chatServer) publishResult(ctx context.Context, req *chatv1.PublishRequest) *chatv1.PublishResult {
+	resp, err := s.publish(ctx, req)
+	if err != nil {
+		st := status.Convert(err)
+		return &chatv1.PublishResult{
+			Result: &chatv1.PublishResult_Error{
+				Error: &chatv1.PublishError{
+					Room:    roomOrDefault(req.GetRoom()),
+					Id:      req.GetId(),
+					Code:    int32(st.Code()),
+					Message: st.Message(),
+				},
+			},
+		}
+	}
+	return &chatv1.PublishResult{
+		Result: &chatv1.PublishResult_Published{Published: resp},
+	}
+}
+
+// Subscribe implements the ChatService Subscribe RPC
+func (s *chatServer) Subscribe(req *chatv1.SubscribeRequest, stream chatv1.ChatService_SubscribeServer) error {
+	ctx := stream.Context()
+	requestID, _ := ctx.Value(model.RequestID).(string)
+	principal := ctx.Value(model.PrincipalKey).(model.Principal)
+
+	room := roomOrDefault(req.GetRoom())
+	if err := s.authorize(ctx, principal, room, core.ScopeRead, core.PermissionRoomRead); err != nil {
+		return err
+	}
+	if req.GetSince() < 0 {
+		return status.Error(codes.InvalidArgument, "invalid since cursor")
+	}
+
+	sub, err := s.chat.ReadMessages(ctx, principal.ClientID, room, req.GetSince())
+	if err != nil {
+		return s.statusError(ctx, "read messages", err)
+	}
+	defer sub.Close()
+
+	s.logger.Info(
+		"subscribed to room",
+		"request_id", requestID,
+		"client_id", principal.ClientID,
+		"room", room,
+		"since", req.GetSince(),
+	)
+
+	expiry := common.ExpiryTimer(principal.ExpiresAt)
+	defer expiry.Stop()
+
+Loop:
+	for {
+		select {
+		case frame, ok := <-sub.Messages():
+			if !ok {
+				break Loop
+			}
+			if err := stream.Send(newMessage(frame)); err != nil {
+				return err
+			}
+		case <-expiry.C:
+			s.logger.Info(
+				"closing subscription of expired token",
+				"request_id", requestID,
+				"client_id", principal.ClientID,
+			)
+			return status.Error(codes.Unauthenticated, "token expired")
+		}
+	}
+
+	err = sub.Err()
+	if errors.Is(err, core.ErrStreamClosed) {
+		s.logger.Warn(
+			"message stream closed",
+			"request_id", requestID,
+			"error", err,
+		)
+		return status.Error(codes.Unavailable, "message stream closed, subscribe again later")
+	}
+	return status.FromContextError(err).Err()
+}
+
+// History implements the ChatService History RPC
+func (s *chatServer) History(ctx context.Context, req *chatv1.HistoryRequest) (*chatv1.HistoryResponse, error) {
+	principal := ctx.Value(model.PrincipalKey).(model.Principal)
+
+	room := roomOrDefault(req.GetRoom())
+	if err := s.authorize(ctx, principal, room, core.ScopeRead, core.PermissionRoomRead); err != nil {
+		return nil, err
+	}
+
+	page, err := s.chat.History(ctx, room, req.GetAfter(), req.GetBefore(), int(req.GetLimit()), time.UTC)
+	if err != nil {
+		return nil, s.statusError(ctx, "history", err)
+	}
+
+	resp := &chatv1.HistoryResponse{
+		Messages: make([]*chatv1.Message, 0, len(page.Messages)),
+		Prev:     page.Prev,
+		Next:     page.Next,
+	}
+	for _, frame := range page.Messages {
+		resp.Messages = append(resp.Messages, newMessage(frame))
+	}
+	return resp, nil
+}
+
+func (s *chatServer) publish(ctx context.Context, req *chatv1.PublishRequest) (*chatv1.PublishResponse, error) {
+	requestID, _ := ctx.Value(model.RequestID).(string)
+	principal := ctx.Value(model.PrincipalKey).(model.Principal)
+	ip, _ := ctx.Value(model.ClientIP).(string)
+
+	room := roomOrDefault(req.GetRoom())
+	if err := s.authorize(ctx, principal, room, core.ScopeWrite, core.PermissionRoomWrite); err != nil {
+		return nil, err
+	}
+
+	err := s.chat.CheckRateLimit(principal.ClientID, room, ip)
+	if err != nil && !errors.Is(err, core.ErrRateLimited) {
+		// the limits are not enforced while the limiter is unavailable
+		s.logger.Error(
+			"check rate limit failed",
+			"request_id", requestID,
+			"error", err,
+		)
+	} else if err != nil {
+		return nil, s.statusError(ctx, "check rate limit", err)
+	}
+
+	var sentAt time.Time
+	if req.GetSentAt() > 0 {
+		sentAt = time.UnixMilli(req.GetSentAt())
+	}
+	cursor, err := s.chat.Publish(ctx, principal.ClientID, room, req.GetId(), req.GetMessage(), sentAt)
+	if err != nil {
+		return nil, s.statusError(ctx, "publish", err)
+	}
+
+	s.logger.Info(
+		"message published successfully",
+		"request_id", requestID,
+		"client_id", principal.ClientID,
+		"room", room,
+		"cursor", cursor,
+	)
+	return &chatv1.PublishResponse{
+		Room:   room,
+		Id:     req.GetId(),
+		Cursor: cursor,
+	}, nil
+}
+
+// authorize checks the token scope, that the room exists and that the
+// principal has the permission in it
+func (s *chatServer) authorize(ctx context.Context, principal model.Principal, room, scope, permission string) error {
+	if !principal.HasScope(scope) {
+		return status.Error(codes.PermissionDenied, "insufficient token scope")
+	}
+	if err := s.chat.CheckRoom(room); err != nil {
+		return s.statusError(ctx, "check room", err)
+	}
+	if err := s.chat.Authorize(principal, room, permission); err != nil {
+		if errors.Is(err, core.ErrPermissionDenied) {
+			return status.Errorf(codes.PermissionDenied, "permission %s required in the room", permission)
+		}
+		return s.statusError(ctx, "authorize room access", err)
+	}
+	return nil
+}
+
+// statusError converts an error returned by the chat service to a grpc status error
+func (s *chatServer) statusError(ctx context.Context, operation string, err error) error {
+	requestID, _ := ctx.Value(model.RequestID).(string)
+
+	var validationErr *core.ValidationError
+	var limitErr *core.RateLimitError
+	switch {
+	case errors.As(err, &validationErr):
+		return status.Errorf(codes.InvalidArgument, "invalid message, %s", validationErr.Reason)
+	case errors.As(err, &limitErr):
+		return status.Errorf(codes.ResourceExhausted, "too many messages per %s, retry after %s", limitErr.Scope, limitErr.RetryAfter)
+	case errors.Is(err, core.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "invalid client credentials")
+	case errors.Is(err, core.ErrInsufficientScope):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, core.ErrTokenIssuingDisabled):
+		return status.Error(codes.Unimplemented, "tokens are issued by another server")
+	case errors.Is(err, core.ErrInvalidIDFormat):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, core.ErrInvalidRoomName), errors.Is(err, core.ErrInvalidHistoryQuery):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, core.ErrRoomNotFound):
+		return status.Error(codes.NotFound, "room not found")
+	}
+
+	s.logger.Error(
+		fmt.Sprintf("chat %s", operation),
+		"request_id", requestID,
+		"error", err,
+	)
+	return status.Error(codes.Internal, "something went wrong on our end")
+}
+
+func roomOrDefault(room string) string {
+	if room == "" {
+		return core.DefaultRoom
+	}
+	return room
+}
+
+func newMessage(frame model.MessageFrame) *chatv1.Message {
+	return &chatv1.Message{
+		Cursor:    frame.ID,
+		Room:      frame.Room,
+		ClientId:  frame.ClientID,
+		Timestamp: frame.Timestamp,
+		SentAt:    frame.SentAt,
+		Message:   frame.Message,
+	}
+}
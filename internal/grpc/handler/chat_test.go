@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	chatv1 "github.com/dgdraganov/crispy-chat-service/api/chat/v1"
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/memory"
+	"github.com/dgdraganov/crispy-chat-service/pkg/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// principalStream attaches the principal to the context of a stream
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *principalStream) Context() context.Context {
+	return s.ctx
+}
+
+// newTestClient serves the chat server on a memory store, every call is made
+// by the principal
+func newTestClient(t *testing.T, principal model.Principal) chatv1.ChatServiceClient {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	chat := core.New(nil, nil, store, nil, store, ratelimit.NewMemory(), core.NewValidationChain(4096), core.NewSystemClock(),
+		core.HubConfig{BufferSize: 16}, core.TokenConfig{},
+		core.ACLConfig{DefaultPermissions: []string{core.PermissionRoomRead, core.PermissionRoomWrite}},
+		core.RateLimitConfig{}, core.PublishConfig{}, logger)
+	if err := chat.CreateRoom(core.DefaultRoom); err != nil {
+		t.Fatalf("create default room: %v", err)
+	}
+
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(
+		func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx := context.WithValue(ss.Context(), model.RequestID, "request")
+			ctx = context.WithValue(ctx, model.PrincipalKey, principal)
+			return handler(srv, &principalStream{ServerStream: ss, ctx: ctx})
+		},
+	))
+	chatv1.RegisterChatServiceServer(server, NewChatServer(chat, logger))
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return chatv1.NewChatServiceClient(conn)
+}
+
+func TestSubscribeEndsOnTokenExpiry(t *testing.T) {
+	client := newTestClient(t, model.Principal{
+		ClientID:  "Jim",
+		Scopes:    []string{core.ScopeRead},
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	stream, err := client.Subscribe(ctx, &chatv1.SubscribeRequest{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	_, err = stream.Recv()
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got error %v, want code %s", err, codes.Unauthenticated)
+	}
+}
+
+func TestPublishStreamEndsOnTokenExpiry(t *testing.T) {
+	client := newTestClient(t, model.Principal{
+		ClientID:  "Jim",
+		Scopes:    []string{core.ScopeWrite},
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	stream, err := client.PublishStream(ctx)
+	if err != nil {
+		t.Fatalf("publish stream: %v", err)
+	}
+
+	// the stream stays open without requests until the token expires
+	_, err = stream.Recv()
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("got error %v, want code %s", err, codes.Unauthenticated)
+	}
+}
+
+func TestPublishStreamReportsEveryMessage(t *testing.T) {
+	client := newTestClient(t, model.Principal{
+		ClientID:  "Jim",
+		Scopes:    []string{core.ScopeWrite},
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	stream, err := client.PublishStream(ctx)
+	if err != nil {
+		t.Fatalf("publish stream: %v", err)
+	}
+
+	requests := []*chatv1.PublishRequest{
+		{Id: "1", Message: "hello"},
+		{Id: "2", Room: "missing", Message: "hello"},
+		{Id: "3", Message: ""},
+		{Id: "4", Message: "bye"},
+	}
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("close send: %v", err)
+	}
+
+	var got []string
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if published := result.GetPublished(); published != nil && published.GetCursor() > 0 {
+			got = append(got, fmt.Sprintf("%s:published", published.GetId()))
+		} else {
+			got = append(got, fmt.Sprintf("%s:%s", result.GetError().GetId(), codes.Code(result.GetError().GetCode())))
+		}
+	}
+
+	want := []string{"1:published", "2:NotFound", "3:InvalidArgument", "4:published"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got results %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type Chat interface {
+	IssueToken(ctx context.Context, credentials model.Credentials, scopes []string) (model.AuthResponse, error)
+	CheckRoom(room string) error
+	Authorize(principal model.Principal, room, permission string) error
+	CheckRateLimit(clientID, room, ip string) error
+	Publish(ctx context.Context, clientID, room, messageID, message string, sentAt time.Time) (int64, error)
+	ReadMessages(ctx context.Context, clientID, room string, since int64) (*core.Subscription, error)
+	History(ctx context.Context, room string, after, before int64, limit int, loc *time.Location) (model.HistoryPage, error)
+}
@@ -0,0 +1,109 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type authInterceptor struct {
+	auth   Authenticator
+	logger *slog.Logger
+	// public holds the full names of the methods that are called without a token
+	public map[string]bool
+}
+
+// NewAuthInterceptor is a constructor function for the authInterceptor type. The
+// public methods, e.g. "/chat.v1.ChatService/Auth", do not require a token.
+func NewAuthInterceptor(auth Authenticator, logger *slog.Logger, publicMethods ...string) *authInterceptor {
+	public := make(map[string]bool, len(publicMethods))
+	for _, method := range publicMethods {
+		public[method] = true
+	}
+	return &authInterceptor{
+		auth:   auth,
+		logger: logger,
+		public: public,
+	}
+}
+
+// Unary verifies the access token of the call and attaches the principal it was
+// issued to to the call context
+func (a *authInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if a.public[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := a.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream verifies the access token of the stream and attaches the principal it
+// was issued to to the stream context
+func (a *authInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if a.public[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		ctx, err := a.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (a *authInterceptor) authenticate(ctx context.Context) (context.Context, error) {
+	requestID, _ := ctx.Value(model.RequestID).(string)
+
+	token := callToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing access token")
+	}
+
+	principal, err := a.auth.Authenticate(token)
+	if errors.Is(err, core.ErrInvalidToken) || errors.Is(err, core.ErrTokenExpired) {
+		a.logger.Warn(
+			"token rejected",
+			"request_id", requestID,
+			"error", err,
+		)
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	if err != nil {
+		a.logger.Error(
+			"authenticate token",
+			"request_id", requestID,
+			"error", err,
+		)
+		return nil, status.Error(codes.Internal, "something went wrong on our end")
+	}
+
+	return context.WithValue(ctx, model.PrincipalKey, principal), nil
+}
+
+// callToken reads the access token from the "authorization: Bearer" metadata
+func callToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get("authorization") {
+		if token, found := strings.CutPrefix(value, "Bearer "); found {
+			return token
+		}
+	}
+	return ""
+}
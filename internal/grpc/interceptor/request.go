@@ -0,0 +1,67 @@
+package interceptor
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+type requestInterceptor struct {
+	logger *slog.Logger
+}
+
+// NewRequestInterceptor is a constructor function for the requestInterceptor type
+func NewRequestInterceptor(logger *slog.Logger) *requestInterceptor {
+	return &requestInterceptor{
+		logger: logger,
+	}
+}
+
+// Unary attaches an unique request id and the client's address to the call context and logs the call
+func (i *requestInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(i.context(ctx, info.FullMethod), req)
+	}
+}
+
+// Stream attaches an unique request id and the client's address to the stream context and logs the call
+func (i *requestInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: i.context(ss.Context(), info.FullMethod)})
+	}
+}
+
+func (i *requestInterceptor) context(ctx context.Context, method string) context.Context {
+	requestID := uuid.New().String()
+	ctx = context.WithValue(ctx, model.RequestID, requestID)
+
+	if p, ok := peer.FromContext(ctx); ok {
+		ip := p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ctx = context.WithValue(ctx, model.ClientIP, ip)
+	}
+
+	i.logger.Info(
+		"incoming grpc call",
+		"method", method,
+		"request_id", requestID,
+	)
+	return ctx
+}
+
+// serverStream replaces the context of a grpc.ServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// stopTimeout bounds the time Shutdown waits for the running calls, e.g.
+// subscriptions, before it closes their connections
+const stopTimeout = time.Second * 5
+
+type grpcServer struct {
+	logger *slog.Logger
+	server *grpc.Server
+}
+
+// NewGRPC is a constructor function for the grpcServer type
+func NewGRPC(server *grpc.Server, logger *slog.Logger) *grpcServer {
+	return &grpcServer{
+		logger: logger,
+		server: server,
+	}
+}
+
+// Start runs the grpc server on the specified port
+func (s *grpcServer) Start(port string) {
+	go func() {
+		s.logger.Info(
+			"gRPC server starting...",
+			"grpc_port", port,
+		)
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+		if err == nil {
+			err = s.server.Serve(listener)
+		}
+		if err != nil {
+			s.logger.Error(
+				"grpc server failed unexpectedly",
+				"error", err,
+			)
+			os.Exit(1)
+		}
+	}()
+}
+
+// Shutdown stops the server gracefully, the calls still running after
+// stopTimeout are cancelled
+func (s *grpcServer) Shutdown() {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(stopTimeout):
+		s.server.Stop()
+	}
+}
@@ -68,7 +68,11 @@ func (handler *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	signature, err := handler.auth.Sign(authReq.ClientID)
+	credentials := model.Credentials{
+		ClientID: authReq.ClientID,
+		Secret:   authReq.Secret,
+	}
+	token, err := handler.auth.IssueToken(r.Context(), credentials, authReq.Scopes)
 	if errors.Is(err, core.ErrInvalidIDFormat) {
 		writer.Write(
 			r.Context(),
@@ -79,9 +83,32 @@ func (handler *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		return
 	}
+	if errors.Is(err, core.ErrInvalidCredentials) {
+		handler.logger.Warn(
+			"invalid client credentials",
+			"request_id", requestID,
+			"client_id", authReq.ClientID,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid client credentials",
+			http.StatusUnauthorized,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrInsufficientScope) {
+		writer.Write(
+			r.Context(),
+			w,
+			err.Error(),
+			http.StatusForbidden,
+		)
+		return
+	}
 	if err != nil {
 		handler.logger.Error(
-			"auth sign error",
+			"auth issue token error",
 			"request_id", requestID,
 			"error", err,
 			"client_id", authReq.ClientID,
@@ -95,10 +122,10 @@ func (handler *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writer.Write(
+	writer.WriteJSON(
 		r.Context(),
 		w,
-		signature,
+		token,
 		http.StatusOK,
 	)
 }
@@ -1,5 +1,15 @@
 package auth
 
+import (
+	"context"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
 type Authenticator interface {
-	Sign(clientID string) (string, error)
+	IssueToken(ctx context.Context, credentials model.Credentials, scopes []string) (model.AuthResponse, error)
+}
+
+type Refresher interface {
+	RefreshToken(token string) (model.AuthResponse, error)
 }
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+)
+
+type refreshHandler struct {
+	method    string
+	refresher Refresher
+	logger    *slog.Logger
+}
+
+// NewRefreshHandler is a constructor function for the refreshHandler type
+func NewRefreshHandler(method string, refresher Refresher, logger *slog.Logger) *refreshHandler {
+	return &refreshHandler{
+		refresher: refresher,
+		logger:    logger,
+		method:    method,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface for the refreshHandler type.
+// It exchanges the token from the request headers for a new one.
+func (handler *refreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(model.RequestID).(string)
+	token := r.Context().Value(model.Signature).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	if r.Method != handler.method {
+		handler.logger.Warn(
+			"invalid request method for auth refresh endpoint",
+			"request_method", r.Method,
+			"expected_request_method", handler.method,
+			"request_id", requestID,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("invalid request method %s, expected method is %s", r.Method, handler.method),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	newToken, err := handler.refresher.RefreshToken(token)
+	if errors.Is(err, core.ErrInvalidToken) || errors.Is(err, core.ErrTokenExpired) {
+		handler.logger.Warn(
+			"token not refreshed",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid or expired token",
+			http.StatusUnauthorized,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"auth refresh token error",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	writer.WriteJSON(
+		r.Context(),
+		w,
+		newToken,
+		http.StatusOK,
+	)
+}
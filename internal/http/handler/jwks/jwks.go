@@ -0,0 +1,74 @@
+package jwks
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+)
+
+type jwksHandler struct {
+	method   string
+	provider KeySetProvider
+	logger   *slog.Logger
+}
+
+// NewHandler is a constructor function for the jwksHandler type
+func NewHandler(method string, provider KeySetProvider, logger *slog.Logger) *jwksHandler {
+	return &jwksHandler{
+		method:   method,
+		provider: provider,
+		logger:   logger,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface for the jwksHandler type.
+// It publishes the public keys that verify the issued tokens.
+func (handler *jwksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(model.RequestID).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	if r.Method != handler.method {
+		handler.logger.Warn(
+			"invalid request method for jwks endpoint",
+			"request_method", r.Method,
+			"expected_request_method", handler.method,
+			"request_id", requestID,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("invalid request method %s, expected method is %s", r.Method, handler.method),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	keySet, err := handler.provider.KeySet()
+	if err != nil {
+		handler.logger.Error(
+			"provider key set",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	// verifiers may cache the keys, but should pick up rotated keys soon
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writer.WriteJSON(
+		r.Context(),
+		w,
+		keySet,
+		http.StatusOK,
+	)
+}
@@ -0,0 +1,7 @@
+package jwks
+
+import "github.com/dgdraganov/crispy-chat-service/pkg/sign"
+
+type KeySetProvider interface {
+	KeySet() (sign.JSONWebKeySet, error)
+}
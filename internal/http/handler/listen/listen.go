@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/dgdraganov/crispy-chat-service/internal/core"
 	"github.com/dgdraganov/crispy-chat-service/internal/model"
@@ -17,21 +19,28 @@ type listenHandler struct {
 	method   string
 	listener Listener
 	logger   *slog.Logger
+	// heartbeatInterval is how often a comment is sent on idle event streams
+	heartbeatInterval time.Duration
+	// keepalive holds the ping, deadline and idle timeout settings of the connections
+	keepalive common.Keepalive
 }
 
 // NewHandler is a cpnstructor function for the listenHandler type
-func NewHandler(method string, listener Listener, logger *slog.Logger) *listenHandler {
+func NewHandler(method string, listener Listener, heartbeatInterval time.Duration, keepalive common.Keepalive, logger *slog.Logger) *listenHandler {
 	return &listenHandler{
-		listener: listener,
-		logger:   logger,
-		method:   method,
+		listener:          listener,
+		logger:            logger,
+		method:            method,
+		heartbeatInterval: heartbeatInterval,
+		keepalive:         keepalive,
 	}
 }
 
 // ServeHTTP implements the http.Handler interface for the listenHandler type
 func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestID := r.Context().Value(model.RequestID).(string)
-	signature := r.Context().Value(model.Signature).(string)
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+	clientId := principal.ClientID
 
 	writer := common.NewWriter(handler.logger)
 
@@ -51,6 +60,16 @@ func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !principal.HasScope(core.ScopeRead) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Insufficient token scope",
+			http.StatusForbidden,
+		)
+		return
+	}
+
 	q, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
 		handler.logger.Error(
@@ -67,32 +86,77 @@ func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	clientId := q.Get("client_id")
-	if clientId == "" {
+	room := q.Get("room")
+	if room == "" {
+		room = core.DefaultRoom
+	}
+
+	format, err := core.ParseMessageFormat(q.Get("format"))
+	if err != nil {
 		writer.Write(
 			r.Context(),
 			w,
-			"Missing client_id query parameter!",
+			"Invalid format! Supported formats are text and json",
 			http.StatusBadRequest,
 		)
 		return
 	}
 
-	valid, err := handler.listener.Verify(signature, clientId)
-	if errors.Is(err, core.ErrInvalidIDFormat) {
+	loc, err := core.ParseTimezone(q.Get("tz"))
+	if err != nil {
 		writer.Write(
 			r.Context(),
 			w,
-			"Invalid client ID!",
+			"Invalid tz! Expected an IANA timezone name, e.g. Europe/Sofia",
 			http.StatusBadRequest,
 		)
 		return
 	}
+
+	// the cursor of the last received message, the header is named after the SSE equivalent
+	cursor := q.Get("since")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+	var since int64
+	if cursor != "" {
+		since, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || since < 0 {
+			writer.Write(
+				r.Context(),
+				w,
+				"Invalid since cursor!",
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+
+	err = handler.listener.CheckRoom(room)
+	if errors.Is(err, core.ErrInvalidRoomName) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid room name!",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrRoomNotFound) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+		return
+	}
 	if err != nil {
 		handler.logger.Error(
-			"listener verify",
+			"listener check room",
 			"request_id", requestID,
 			"error", err,
+			"room", room,
 		)
 		writer.Write(
 			r.Context(),
@@ -100,18 +164,92 @@ func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			"Something went wrong on our end!",
 			http.StatusInternalServerError,
 		)
+		return
+	}
+
+	err = handler.listener.Authorize(principal, room, core.PermissionRoomRead)
+	if errors.Is(err, core.ErrPermissionDenied) {
+		handler.logger.Warn(
+			"client not allowed to read the room",
+			"request_id", requestID,
+			"client_id", principal.ClientID,
+			"room", room,
+		)
+		writer.RejectWebsocket(
+			r.Context(),
+			w,
+			r,
+			websocket.ClosePolicyViolation,
+			"Not allowed to read the room!",
+			http.StatusForbidden,
+		)
+		return
 	}
-	if !valid {
+	if err != nil {
+		handler.logger.Error(
+			"authorize room access",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.RejectWebsocket(
+			r.Context(),
+			w,
+			r,
+			websocket.CloseInternalServerErr,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	sub, err := handler.listener.ReadMessages(r.Context(), clientId, room, since)
+	if errors.Is(err, core.ErrInvalidRoomName) {
 		writer.Write(
 			r.Context(),
 			w,
-			"Invalid signature",
+			"Invalid room name!",
 			http.StatusBadRequest,
 		)
 		return
 	}
+	if errors.Is(err, core.ErrRoomNotFound) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"listener read messages",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	defer sub.Close()
 
-	msgChan := handler.listener.ReadMessages(r.Context(), clientId)
+	if common.AcceptsEventStream(r) {
+		handler.logger.Info(
+			"streaming server-sent events",
+			"request_id", requestID,
+			"client_id", clientId,
+			"room", room,
+			"since", since,
+		)
+		handler.streamEvents(r.Context(), w, sub, principal, format, loc)
+		return
+	}
 
 	var upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -135,10 +273,22 @@ func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		"upgraded to websockets",
 		"request_id", requestID,
 		"client_id", clientId,
+		"room", room,
+		"since", since,
 	)
 
+	// the client only answers pings, the pongs and the messages sent to it are the activity of the connection
+	heartbeat := handler.keepalive.Start(conn)
+	defer heartbeat.Stop()
+
+	expiry := common.ExpiryTimer(principal.ExpiresAt)
+	defer expiry.Stop()
+
+	// done is closed when the client closes the connection, the read loop also
+	// exits once the connection is closed by the handler
 	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for {
 			mt, _, err := conn.ReadMessage()
 			if err != nil {
@@ -146,13 +296,11 @@ func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 					"conn read message",
 					"error", err,
 				)
-				done <- struct{}{}
-				break
+				return
 			}
 			if mt == websocket.CloseMessage {
 				handler.logger.Info("sending close message")
-				done <- struct{}{}
-				break
+				return
 			}
 		}
 	}()
@@ -160,8 +308,34 @@ func (handler *listenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 Loop:
 	for {
 		select {
-		case msg := <-msgChan:
-			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		case frame, ok := <-sub.Messages():
+			if !ok {
+				handler.logger.Info(
+					"message stream closed",
+					"request_id", requestID,
+					"error", sub.Err(),
+				)
+				conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
+				if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "message stream closed")); err != nil {
+					handler.logger.Error(
+						"sending close message failed",
+						"request_id", requestID,
+						"error", err,
+					)
+				}
+				break Loop
+			}
+			msg, err := format.Render(frame, loc)
+			if err != nil {
+				handler.logger.Error(
+					"render message failed - discarding message",
+					"request_id", requestID,
+					"error", err,
+				)
+				continue
+			}
+			conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
 				handler.logger.Error(
 					"write message error",
 					"request_id", requestID,
@@ -169,13 +343,45 @@ Loop:
 				)
 				break Loop
 			}
+			heartbeat.Touch()
 		case <-done:
 			break Loop
+		case <-heartbeat.Idle():
+			handler.logger.Info(
+				"closing idle connection",
+				"request_id", requestID,
+				"idle_timeout", handler.keepalive.IdleTimeout,
+			)
+			conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
+			if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Connection idle for too long!")); err != nil {
+				handler.logger.Error(
+					"sending close message failed",
+					"request_id", requestID,
+					"error", err,
+				)
+			}
+			break Loop
+		case <-expiry.C:
+			handler.logger.Info(
+				"closing connection of expired token",
+				"request_id", requestID,
+				"client_id", clientId,
+			)
+			conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
+			if err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Token expired!")); err != nil {
+				handler.logger.Error(
+					"sending close message failed",
+					"request_id", requestID,
+					"error", err,
+				)
+			}
+			break Loop
 		case <-r.Context().Done():
 			handler.logger.Info(
 				"closing connection",
 				"request_id", requestID,
 			)
+			conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
 			if err := conn.WriteMessage(websocket.CloseMessage, []byte("closing connection")); err != nil {
 				handler.logger.Error(
 					"sending close message failed",
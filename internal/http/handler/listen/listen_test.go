@@ -0,0 +1,91 @@
+package listen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+	"github.com/dgdraganov/crispy-chat-service/pkg/memory"
+	"github.com/dgdraganov/crispy-chat-service/pkg/ratelimit"
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves the handler on a memory store, every request is made by
+// the principal
+func newTestServer(t *testing.T, principal model.Principal) *httptest.Server {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	chat := core.New(nil, nil, store, nil, store, ratelimit.NewMemory(), core.NewValidationChain(4096), core.NewSystemClock(),
+		core.HubConfig{BufferSize: 16}, core.TokenConfig{},
+		core.ACLConfig{DefaultPermissions: []string{core.PermissionRoomRead, core.PermissionRoomWrite}},
+		core.RateLimitConfig{}, core.PublishConfig{}, logger)
+	if err := chat.CreateRoom(core.DefaultRoom); err != nil {
+		t.Fatalf("create default room: %v", err)
+	}
+
+	handler := NewHandler(http.MethodGet, chat, time.Minute, common.Keepalive{}, logger)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), model.RequestID, "request")
+		ctx = context.WithValue(ctx, model.PrincipalKey, principal)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListenClosesOnTokenExpiry(t *testing.T) {
+	server := newTestServer(t, model.Principal{
+		ClientID:  "Jim",
+		Scopes:    []string{core.ScopeRead},
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("got error %v, want close code %d", err, websocket.ClosePolicyViolation)
+	}
+}
+
+func TestEventStreamEndsOnTokenExpiry(t *testing.T) {
+	server := newTestServer(t, model.Principal{
+		ClientID:  "Jim",
+		Scopes:    []string{core.ScopeRead},
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	r.Header.Set("Accept", common.EventStreamType)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("get event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("event stream not ended by the server: %v", err)
+	}
+}
@@ -1,8 +1,14 @@
 package listen
 
-import "context"
+import (
+	"context"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
 
 type Listener interface {
-	Verify(signature, clientID string) (bool, error)
-	ReadMessages(ctx context.Context, clientID string) chan string
+	CheckRoom(room string) error
+	Authorize(principal model.Principal, room, permission string) error
+	ReadMessages(ctx context.Context, clientID, room string, since int64) (*core.Subscription, error)
 }
@@ -0,0 +1,142 @@
+package listen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+)
+
+// streamEvents sends every message as a Server-Sent Event with the message
+// cursor as its ID, so that a reconnecting EventSource resumes after the last
+// received message. A comment is sent every heartbeat interval to keep idle
+// connections open through proxies, the stream ends when no message or
+// heartbeat could be written for the idle timeout or the token of the
+// principal expires.
+func (handler *listenHandler) streamEvents(ctx context.Context, w http.ResponseWriter, sub *core.Subscription, principal model.Principal, format core.MessageFormat, loc *time.Location) {
+	requestID := ctx.Value(model.RequestID).(string)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handler.logger.Error(
+			"response writer does not support flushing",
+			"request_id", requestID,
+		)
+		http.Error(w, "Streaming not supported!", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", common.EventStreamType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(handler.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// idle is nil and never ready without an idle timeout
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if handler.keepalive.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(handler.keepalive.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	expiry := common.ExpiryTimer(principal.ExpiresAt)
+	defer expiry.Stop()
+
+	// bound every write so that a dead client does not block the stream forever,
+	// the deadline is not supported by every response writer
+	rc := http.NewResponseController(w)
+
+	for {
+		select {
+		case frame, ok := <-sub.Messages():
+			if !ok {
+				handler.logger.Info(
+					"message stream closed",
+					"request_id", requestID,
+					"error", sub.Err(),
+				)
+				return
+			}
+			msg, err := format.Render(frame, loc)
+			if err != nil {
+				handler.logger.Error(
+					"render message failed - discarding message",
+					"request_id", requestID,
+					"error", err,
+				)
+				continue
+			}
+			rc.SetWriteDeadline(handler.keepalive.WriteDeadline())
+			if _, err := w.Write(formatEvent(frame.ID, msg)); err != nil {
+				handler.logger.Error(
+					"write event error",
+					"request_id", requestID,
+					"error", err,
+				)
+				return
+			}
+			flusher.Flush()
+			if idleTimer != nil {
+				idleTimer.Reset(handler.keepalive.IdleTimeout)
+			}
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(handler.keepalive.WriteDeadline())
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				handler.logger.Error(
+					"write heartbeat error",
+					"request_id", requestID,
+					"error", err,
+				)
+				return
+			}
+			flusher.Flush()
+			if idleTimer != nil {
+				idleTimer.Reset(handler.keepalive.IdleTimeout)
+			}
+		case <-idle:
+			handler.logger.Info(
+				"closing idle event stream",
+				"request_id", requestID,
+				"idle_timeout", handler.keepalive.IdleTimeout,
+			)
+			return
+		case <-expiry.C:
+			handler.logger.Info(
+				"closing event stream of expired token",
+				"request_id", requestID,
+				"client_id", principal.ClientID,
+			)
+			return
+		case <-ctx.Done():
+			handler.logger.Info(
+				"closing event stream",
+				"request_id", requestID,
+			)
+			return
+		}
+	}
+}
+
+// formatEvent encodes a message event, every line of the message becomes a data field
+func formatEvent(id int64, msg []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "id: %d\nevent: %s\n", id, model.FrameTypeMessage)
+	for _, line := range strings.Split(strings.TrimSuffix(string(msg), "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
@@ -1,8 +1,15 @@
 package push
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
 
 type Publisher interface {
-	Verify(signature, clientID string) (bool, error)
-	Publish(ctx context.Context, clientID, message string) error
+	CheckRoom(room string) error
+	Authorize(principal model.Principal, room, permission string) error
+	CheckRateLimit(clientID, room, ip string) error
+	Publish(ctx context.Context, clientID, room, messageID, message string, sentAt time.Time) (int64, error)
 }
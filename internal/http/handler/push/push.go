@@ -2,6 +2,7 @@ package push
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -19,21 +20,31 @@ type pushHandler struct {
 	method    string
 	publisher Publisher
 	logger    *slog.Logger
+	// maxFrameSize is the size in bytes of the largest websocket frame read from the client
+	maxFrameSize int64
+	// maxViolations is the number of rate limited messages in a row after which the client is disconnected
+	maxViolations int
+	// keepalive holds the ping, deadline and idle timeout settings of the connections
+	keepalive common.Keepalive
 }
 
 // NewHandler is a cpnstructor function for the authHandler type
-func NewHandler(method string, publisher Publisher, logger *slog.Logger) *pushHandler {
+func NewHandler(method string, publisher Publisher, maxFrameSize int64, maxViolations int, keepalive common.Keepalive, logger *slog.Logger) *pushHandler {
 	return &pushHandler{
-		publisher: publisher,
-		logger:    logger,
-		method:    method,
+		publisher:     publisher,
+		logger:        logger,
+		method:        method,
+		maxFrameSize:  maxFrameSize,
+		maxViolations: maxViolations,
+		keepalive:     keepalive,
 	}
 }
 
 // ServeHTTP implements the http.Handler interface for the authHandler type
 func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestID := r.Context().Value(model.RequestID).(string)
-	signature := r.Context().Value(model.Signature).(string)
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+	clientID := principal.ClientID
 
 	writer := common.NewWriter(handler.logger)
 
@@ -53,6 +64,16 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !principal.HasScope(core.ScopeWrite) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Insufficient token scope",
+			http.StatusForbidden,
+		)
+		return
+	}
+
 	q, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
 		handler.logger.Error(
@@ -69,12 +90,18 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientID := q.Get("client_id")
-	if clientID == "" {
+	room := q.Get("room")
+	if room == "" {
+		room = core.DefaultRoom
+	}
+
+	// with format=json every frame is a model.PushRequest, otherwise it is the plain message
+	format := q.Get("format")
+	if format != "" && format != "text" && format != "json" {
 		writer.Write(
 			r.Context(),
 			w,
-			"Missing client_id query parameter!",
+			"Invalid format! Supported formats are text and json",
 			http.StatusBadRequest,
 		)
 		return
@@ -82,21 +109,31 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.WithValue(r.Context(), model.ClientID, clientID)
 
-	valid, err := handler.publisher.Verify(signature, clientID)
-	if errors.Is(err, core.ErrInvalidIDFormat) {
+	err = handler.publisher.CheckRoom(room)
+	if errors.Is(err, core.ErrInvalidRoomName) {
 		writer.Write(
 			r.Context(),
 			w,
-			"Invalid client ID!",
+			"Invalid room name!",
 			http.StatusBadRequest,
 		)
 		return
 	}
+	if errors.Is(err, core.ErrRoomNotFound) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+		return
+	}
 	if err != nil {
 		handler.logger.Error(
-			"listener verify",
+			"publisher check room",
 			"request_id", requestID,
 			"error", err,
+			"room", room,
 		)
 		writer.Write(
 			r.Context(),
@@ -104,13 +141,41 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"Something went wrong on our end!",
 			http.StatusInternalServerError,
 		)
+		return
 	}
-	if !valid {
-		writer.Write(
+
+	err = handler.publisher.Authorize(principal, room, core.PermissionRoomWrite)
+	if errors.Is(err, core.ErrPermissionDenied) {
+		handler.logger.Warn(
+			"client not allowed to write to the room",
+			"request_id", requestID,
+			"client_id", principal.ClientID,
+			"room", room,
+		)
+		writer.RejectWebsocket(
 			r.Context(),
 			w,
-			"Invalid signature",
-			http.StatusBadRequest,
+			r,
+			websocket.ClosePolicyViolation,
+			"Not allowed to write to the room!",
+			http.StatusForbidden,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"authorize room access",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.RejectWebsocket(
+			r.Context(),
+			w,
+			r,
+			websocket.CloseInternalServerErr,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
 		)
 		return
 	}
@@ -131,13 +196,27 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	// a larger frame closes the connection with the close code 1009 (message too big)
+	if handler.maxFrameSize > 0 {
+		conn.SetReadLimit(handler.maxFrameSize)
+	}
 
 	handler.logger.Info(
 		"upgraded to websockets",
 		"request_id", requestID,
 		"client_id", clientID,
+		"room", room,
 	)
 
+	ip, _ := r.Context().Value(model.ClientIP).(string)
+	violations := 0
+
+	heartbeat := handler.keepalive.Start(conn)
+	defer heartbeat.Stop()
+
+	expiry := common.ExpiryTimer(principal.ExpiresAt)
+	defer expiry.Stop()
+
 	msgChan := make(chan string)
 	go handler.readingMessages(ctx, conn, msgChan)
 
@@ -146,30 +225,134 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case <-r.Context().Done():
 			handler.closingConnection(ctx, conn)
 			return
+		case <-heartbeat.Idle():
+			handler.logger.Info(
+				"closing idle connection",
+				"request_id", requestID,
+				"idle_timeout", handler.keepalive.IdleTimeout,
+			)
+			handler.disconnect(ctx, conn, websocket.CloseNormalClosure, "Connection idle for too long!")
+			return
+		case <-expiry.C:
+			handler.logger.Info(
+				"closing connection of expired token",
+				"request_id", requestID,
+				"client_id", clientID,
+			)
+			handler.disconnect(ctx, conn, websocket.ClosePolicyViolation, "Token expired!")
+			return
 		case msg, ok := <-msgChan:
 			if !ok {
 				return
 			}
-			err = handler.publisher.Publish(ctx, clientID, msg)
+			heartbeat.Touch()
+			pushReq := model.PushRequest{Message: msg}
+			if format == "json" {
+				if err := json.Unmarshal([]byte(msg), &pushReq); err != nil {
+					handler.logger.Error(
+						"json unmarshal push request - discarding message",
+						"request_id", requestID,
+						"error", err,
+					)
+					handler.writeFrame(ctx, conn, model.ErrorFrame{
+						Type:    model.FrameTypeError,
+						Code:    "invalid_frame",
+						Message: "Invalid JSON frame, message discarded!",
+					})
+					continue
+				}
+			}
+
+			err = handler.publisher.CheckRateLimit(clientID, room, ip)
+			var limitErr *core.RateLimitError
+			if errors.As(err, &limitErr) {
+				// the room limit is shared, only the client's own limits count as violations
+				if limitErr.Violation() {
+					violations++
+				}
+				handler.logger.Warn(
+					"rate limit exceeded - discarding message",
+					"request_id", requestID,
+					"client_id", clientID,
+					"room", room,
+					"ip", ip,
+					"scope", limitErr.Scope,
+					"violations", violations,
+				)
+				if handler.maxViolations > 0 && violations >= handler.maxViolations {
+					handler.disconnect(ctx, conn, websocket.ClosePolicyViolation, "Rate limit exceeded too many times!")
+					return
+				}
+				handler.writeFrame(ctx, conn, model.ErrorFrame{
+					Type:       model.FrameTypeError,
+					ID:         pushReq.ID,
+					Code:       "rate_limited",
+					Message:    fmt.Sprintf("Too many messages per %s, message discarded!", limitErr.Scope),
+					RetryAfter: limitErr.RetryAfter.Milliseconds(),
+				})
+				continue
+			}
 			if err != nil {
+				// the limits are not enforced while the limiter is unavailable
 				handler.logger.Error(
-					"publish message failed",
+					"check rate limit failed",
 					"request_id", requestID,
 					"error", err,
 				)
-				writer.Write(
-					ctx,
-					w,
-					"Something went wrong on our end!",
-					http.StatusInternalServerError,
+			}
+			violations = 0
+
+			var sentAt time.Time
+			if pushReq.SentAt > 0 {
+				sentAt = time.UnixMilli(pushReq.SentAt)
+			}
+			cursor, err := handler.publisher.Publish(ctx, clientID, room, pushReq.ID, pushReq.Message, sentAt)
+			var validationErr *core.ValidationError
+			if errors.As(err, &validationErr) {
+				handler.logger.Warn(
+					"invalid message - discarding message",
+					"request_id", requestID,
+					"client_id", clientID,
+					"room", room,
+					"code", validationErr.Code,
 				)
+				handler.writeFrame(ctx, conn, model.ErrorFrame{
+					Type:    model.FrameTypeError,
+					ID:      pushReq.ID,
+					Code:    validationErr.Code,
+					Message: fmt.Sprintf("Invalid message, %s!", validationErr.Reason),
+				})
+				continue
+			}
+			if err != nil {
+				handler.logger.Error(
+					"publish message failed",
+					"request_id", requestID,
+					"error", err,
+				)
+				handler.writeFrame(ctx, conn, model.ErrorFrame{
+					Type:    model.FrameTypeError,
+					ID:      pushReq.ID,
+					Code:    "internal_error",
+					Message: "Something went wrong on our end, message not stored!",
+				})
 				continue
 			}
 			handler.logger.Info(
 				"message published successfully",
 				"request_id", requestID,
 				"client_id", clientID,
+				"room", room,
+				"cursor", cursor,
 			)
+			// text clients send plain messages and cannot match acks to them
+			if format == "json" {
+				handler.writeFrame(ctx, conn, model.AckFrame{
+					Type:   model.FrameTypeAck,
+					ID:     pushReq.ID,
+					Cursor: cursor,
+				})
+			}
 		}
 	}
 }
@@ -177,6 +360,7 @@ func (handler *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (handler *pushHandler) closingConnection(ctx context.Context, conn *websocket.Conn) {
 	requestID := ctx.Value(model.RequestID).(string)
 
+	conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
 	err := conn.WriteMessage(websocket.CloseMessage, []byte("closing connection"))
 	if err != nil {
 		handler.logger.Error(
@@ -188,12 +372,50 @@ func (handler *pushHandler) closingConnection(ctx context.Context, conn *websock
 	conn.Close()
 }
 
+// writeFrame sends an ack or error frame to the client
+func (handler *pushHandler) writeFrame(ctx context.Context, conn *websocket.Conn, frame any) {
+	requestID := ctx.Value(model.RequestID).(string)
+
+	conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
+	if err := conn.WriteJSON(frame); err != nil {
+		handler.logger.Error(
+			"write frame",
+			"request_id", requestID,
+			"error", err,
+		)
+	}
+}
+
+// disconnect closes the connection with the close code and reason
+func (handler *pushHandler) disconnect(ctx context.Context, conn *websocket.Conn, closeCode int, reason string) {
+	requestID := ctx.Value(model.RequestID).(string)
+
+	conn.SetWriteDeadline(handler.keepalive.WriteDeadline())
+	err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason))
+	if err != nil {
+		handler.logger.Error(
+			"conn writing close message",
+			"request_id", requestID,
+			"error", err,
+		)
+	}
+	conn.Close()
+}
+
 func (handler *pushHandler) readingMessages(ctx context.Context, conn *websocket.Conn, msgChan chan string) {
 	requestID := ctx.Value(model.RequestID).(string)
 
 Loop:
 	for {
 		msgType, b, err := conn.ReadMessage()
+		if errors.Is(err, websocket.ErrReadLimit) {
+			handler.logger.Warn(
+				"frame exceeds the read limit - closing connection",
+				"request_id", requestID,
+				"max_frame_size", handler.maxFrameSize,
+			)
+			break
+		}
 		if err != nil {
 			handler.logger.Error(
 				"read message error",
@@ -214,8 +436,6 @@ Loop:
 		case <-ctx.Done():
 			break Loop
 		case msgChan <- string(b):
-			<-time.After(time.Millisecond * 100)
-			continue
 		}
 
 	}
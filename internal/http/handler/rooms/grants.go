@@ -0,0 +1,137 @@
+package rooms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+)
+
+// grants serves the grants of the room, every request requires the room:admin permission
+func (handler *roomsHandler) grants(w http.ResponseWriter, r *http.Request, room, clientID string) {
+	requestID := r.Context().Value(model.RequestID).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	if err := core.ValidateRoom(room); err != nil {
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid room name!",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if !handler.authorize(w, r, room, core.PermissionRoomAdmin) {
+		return
+	}
+
+	var err error
+	switch {
+	case clientID == "" && r.Method == http.MethodGet:
+		var grants []model.Grant
+		grants, err = handler.manager.Grants(room)
+		if err == nil {
+			writer.WriteJSON(
+				r.Context(),
+				w,
+				model.GrantsResponse{Room: room, Grants: grants},
+				http.StatusOK,
+			)
+			return
+		}
+	case clientID != "" && r.Method == http.MethodPut:
+		grantReq := model.GrantRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&grantReq); err != nil {
+			handler.logger.Error(
+				"json decode",
+				"request_id", requestID,
+				"error", err,
+			)
+			writer.Write(
+				r.Context(),
+				w,
+				"invalid JSON request body",
+				http.StatusBadRequest,
+			)
+			return
+		}
+		err = handler.manager.SetGrant(room, clientID, grantReq.Permissions)
+		if err == nil {
+			writer.WriteJSON(
+				r.Context(),
+				w,
+				model.Grant{ClientID: clientID, Permissions: grantReq.Permissions},
+				http.StatusOK,
+			)
+			return
+		}
+	case clientID != "" && r.Method == http.MethodDelete:
+		err = handler.manager.DeleteGrant(room, clientID)
+		if err == nil {
+			writer.Write(
+				r.Context(),
+				w,
+				clientID,
+				http.StatusOK,
+			)
+			return
+		}
+	default:
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("invalid request method %s for %s", r.Method, r.URL.Path),
+			http.StatusMethodNotAllowed,
+		)
+		return
+	}
+
+	switch {
+	case errors.Is(err, core.ErrInvalidPermission) || errors.Is(err, core.ErrInvalidIDFormat):
+		writer.Write(
+			r.Context(),
+			w,
+			err.Error(),
+			http.StatusBadRequest,
+		)
+	case errors.Is(err, core.ErrRoomNotFound):
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+	case errors.Is(err, core.ErrGrantNotFound):
+		writer.Write(
+			r.Context(),
+			w,
+			"Grant not found!",
+			http.StatusNotFound,
+		)
+	case errors.Is(err, core.ErrGrantsReadOnly):
+		writer.Write(
+			r.Context(),
+			w,
+			"Grants are managed in the policy file!",
+			http.StatusConflict,
+		)
+	default:
+		handler.logger.Error(
+			"room manager grants",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+	}
+}
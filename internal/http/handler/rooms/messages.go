@@ -0,0 +1,148 @@
+package rooms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+)
+
+// publish stores the message given in the JSON body and returns its cursor, the
+// body is the same as a /push frame with format=json
+func (handler *roomsHandler) publish(w http.ResponseWriter, r *http.Request, room string) {
+	requestID := r.Context().Value(model.RequestID).(string)
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+	ip, _ := r.Context().Value(model.ClientIP).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	if handler.maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, handler.maxBodySize)
+	}
+	pushReq := model.PushRequest{}
+	err := json.NewDecoder(r.Body).Decode(&pushReq)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("Request body is larger than %d bytes!", maxBytesErr.Limit),
+			http.StatusRequestEntityTooLarge,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"json decode",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"invalid JSON request body",
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	err = handler.manager.CheckRateLimit(principal.ClientID, room, ip)
+	var limitErr *core.RateLimitError
+	if errors.As(err, &limitErr) {
+		handler.logger.Warn(
+			"rate limit exceeded - discarding message",
+			"request_id", requestID,
+			"client_id", principal.ClientID,
+			"room", room,
+			"ip", ip,
+			"scope", limitErr.Scope,
+		)
+		retryAfter := math.Ceil(limitErr.RetryAfter.Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("Too many messages per %s, message discarded!", limitErr.Scope),
+			http.StatusTooManyRequests,
+		)
+		return
+	}
+	if err != nil {
+		// the limits are not enforced while the limiter is unavailable
+		handler.logger.Error(
+			"check rate limit failed",
+			"request_id", requestID,
+			"error", err,
+		)
+	}
+
+	var sentAt time.Time
+	if pushReq.SentAt > 0 {
+		sentAt = time.UnixMilli(pushReq.SentAt)
+	}
+	cursor, err := handler.manager.Publish(r.Context(), principal.ClientID, room, pushReq.ID, pushReq.Message, sentAt)
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("Invalid message, %s!", validationErr.Reason),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrInvalidRoomName) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid room name!",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrRoomNotFound) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"room manager publish",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	handler.logger.Info(
+		"message published successfully",
+		"request_id", requestID,
+		"client_id", principal.ClientID,
+		"room", room,
+		"cursor", cursor,
+	)
+	writer.WriteJSON(
+		r.Context(),
+		w,
+		model.PublishResponse{ID: cursor, Room: room},
+		http.StatusCreated,
+	)
+}
@@ -0,0 +1,22 @@
+package rooms
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type RoomManager interface {
+	CreateRoom(room string) error
+	ListRooms() ([]string, error)
+	DeleteRoom(room string) error
+	Authorize(principal model.Principal, room, permission string) error
+	Grants(room string) ([]model.Grant, error)
+	SetGrant(room, clientID string, permissions []string) error
+	DeleteGrant(room, clientID string) error
+	History(ctx context.Context, room string, after, before int64, limit int, loc *time.Location) (model.HistoryPage, error)
+	WaitMessages(ctx context.Context, room string, after int64, wait time.Duration) (bool, error)
+	CheckRateLimit(clientID, room, ip string) error
+	Publish(ctx context.Context, clientID, room, messageID, message string, sentAt time.Time) (int64, error)
+}
@@ -0,0 +1,431 @@
+package rooms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+)
+
+type roomsHandler struct {
+	prefix  string
+	manager RoomManager
+	logger  *slog.Logger
+	// maxBodySize is the size in bytes of the largest published message request body
+	maxBodySize int64
+}
+
+// NewHandler is a constructor function for the roomsHandler type.
+// The prefix is the path the handler is mounted on, e.g. "/rooms".
+func NewHandler(prefix string, manager RoomManager, maxBodySize int64, logger *slog.Logger) *roomsHandler {
+	return &roomsHandler{
+		prefix:      strings.TrimSuffix(prefix, "/"),
+		manager:     manager,
+		logger:      logger,
+		maxBodySize: maxBodySize,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface for the roomsHandler type
+//
+//	GET    /rooms        lists the rooms the principal may read
+//	POST   /rooms        creates the room given in the JSON body
+//	DELETE /rooms/{room} deletes the room and all of its messages
+//	GET    /rooms/{room}/messages?after=&before=&limit=&tz=&wait= reads a page of stored messages
+//	POST   /rooms/{room}/messages publishes the message given in the JSON body
+//	GET    /rooms/{room}/grants lists the grants of the room
+//	PUT    /rooms/{room}/grants/{client_id} replaces the client's permissions given in the JSON body
+//	DELETE /rooms/{room}/grants/{client_id} removes the client's grant
+func (handler *roomsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+
+	writer := common.NewWriter(handler.logger)
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, handler.prefix), "/")
+	room, resource, _ := strings.Cut(path, "/")
+	resource, clientID, _ := strings.Cut(resource, "/")
+
+	// grants are managed by the room admins, which is checked per room
+	if room != "" && resource == "grants" {
+		handler.grants(w, r, room, clientID)
+		return
+	}
+
+	// reading rooms and messages requires the read scope, publishing messages the
+	// write scope and changing rooms the admin scope
+	scope := core.ScopeRead
+	if resource == "messages" && r.Method == http.MethodPost {
+		scope = core.ScopeWrite
+	} else if r.Method != http.MethodGet {
+		scope = core.ScopeRoomsAdmin
+	}
+	if !principal.HasScope(scope) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Insufficient token scope",
+			http.StatusForbidden,
+		)
+		return
+	}
+
+	switch {
+	case room != "" && resource == "messages" && clientID == "" && r.Method == http.MethodGet:
+		if !handler.authorize(w, r, room, core.PermissionRoomRead) {
+			return
+		}
+		handler.history(w, r, room)
+	case room != "" && resource == "messages" && clientID == "" && r.Method == http.MethodPost:
+		if !handler.authorize(w, r, room, core.PermissionRoomWrite) {
+			return
+		}
+		handler.publish(w, r, room)
+	case resource != "":
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("%s not found", r.URL.Path),
+			http.StatusNotFound,
+		)
+	case room == "" && r.Method == http.MethodGet:
+		handler.list(w, r)
+	case room == "" && r.Method == http.MethodPost:
+		handler.create(w, r)
+	case room != "" && r.Method == http.MethodDelete:
+		handler.delete(w, r, room)
+	default:
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("invalid request method %s for %s", r.Method, r.URL.Path),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
+
+// authorize checks that the principal has the permission in the room and
+// writes the error response if not
+func (handler *roomsHandler) authorize(w http.ResponseWriter, r *http.Request, room, permission string) bool {
+	requestID := r.Context().Value(model.RequestID).(string)
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+
+	writer := common.NewWriter(handler.logger)
+
+	err := handler.manager.Authorize(principal, room, permission)
+	if errors.Is(err, core.ErrPermissionDenied) {
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("Permission %s required in the room!", permission),
+			http.StatusForbidden,
+		)
+		return false
+	}
+	if err != nil {
+		handler.logger.Error(
+			"room manager authorize",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return false
+	}
+	return true
+}
+
+func (handler *roomsHandler) list(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(model.RequestID).(string)
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+
+	writer := common.NewWriter(handler.logger)
+
+	rooms, err := handler.manager.ListRooms()
+	if err != nil {
+		handler.logger.Error(
+			"room manager list rooms",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	// rooms the principal has no read permission in are not disclosed
+	readable := []string{}
+	for _, room := range rooms {
+		err := handler.manager.Authorize(principal, room, core.PermissionRoomRead)
+		if errors.Is(err, core.ErrPermissionDenied) {
+			continue
+		}
+		if err != nil {
+			handler.logger.Error(
+				"room manager authorize",
+				"request_id", requestID,
+				"error", err,
+				"room", room,
+			)
+			writer.Write(
+				r.Context(),
+				w,
+				"Something went wrong on our end!",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+		readable = append(readable, room)
+	}
+
+	writer.WriteJSON(
+		r.Context(),
+		w,
+		model.RoomsResponse{Rooms: readable},
+		http.StatusOK,
+	)
+}
+
+func (handler *roomsHandler) create(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(model.RequestID).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	roomReq := model.RoomRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&roomReq); err != nil {
+		handler.logger.Error(
+			"json decode",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"invalid JSON request body",
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	err := handler.manager.CreateRoom(roomReq.Name)
+	if errors.Is(err, core.ErrInvalidRoomName) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid room name! Allowed are up to 64 letters, digits, '_' and '-'",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrRoomExists) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room already exists!",
+			http.StatusConflict,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"room manager create room",
+			"request_id", requestID,
+			"error", err,
+			"room", roomReq.Name,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	writer.Write(
+		r.Context(),
+		w,
+		roomReq.Name,
+		http.StatusCreated,
+	)
+}
+
+func (handler *roomsHandler) delete(w http.ResponseWriter, r *http.Request, room string) {
+	requestID := r.Context().Value(model.RequestID).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	err := handler.manager.DeleteRoom(room)
+	if errors.Is(err, core.ErrInvalidRoomName) || errors.Is(err, core.ErrDefaultRoom) {
+		writer.Write(
+			r.Context(),
+			w,
+			err.Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrRoomNotFound) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"room manager delete room",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	writer.Write(
+		r.Context(),
+		w,
+		room,
+		http.StatusOK,
+	)
+}
+
+func (handler *roomsHandler) history(w http.ResponseWriter, r *http.Request, room string) {
+	requestID := r.Context().Value(model.RequestID).(string)
+
+	writer := common.NewWriter(handler.logger)
+
+	q := r.URL.Query()
+
+	var cursors [2]int64
+	for i, param := range []string{"after", "before"} {
+		if q.Get(param) == "" {
+			continue
+		}
+		cursor, err := strconv.ParseInt(q.Get(param), 10, 64)
+		if err != nil || cursor < 0 {
+			writer.Write(
+				r.Context(),
+				w,
+				fmt.Sprintf("Invalid %s cursor!", param),
+				http.StatusBadRequest,
+			)
+			return
+		}
+		cursors[i] = cursor
+	}
+
+	var limit int
+	if q.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			writer.Write(
+				r.Context(),
+				w,
+				"Invalid limit!",
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+
+	loc, err := core.ParseTimezone(q.Get("tz"))
+	if err != nil {
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid tz! Expected an IANA timezone name, e.g. Europe/Sofia",
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	// with wait and an after cursor the request is held until a newer message is stored
+	var wait time.Duration
+	if q.Get("wait") != "" {
+		wait, err = time.ParseDuration(q.Get("wait"))
+		if err != nil || wait <= 0 || wait > core.MaxHistoryWait || cursors[0] == 0 {
+			writer.Write(
+				r.Context(),
+				w,
+				fmt.Sprintf("Invalid wait! Expected a duration of up to %s together with an after cursor", core.MaxHistoryWait),
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+
+	page, err := handler.manager.History(r.Context(), room, cursors[0], cursors[1], limit, loc)
+	if err == nil && len(page.Messages) == 0 && wait > 0 {
+		var found bool
+		found, err = handler.manager.WaitMessages(r.Context(), room, cursors[0], wait)
+		if err == nil && found {
+			page, err = handler.manager.History(r.Context(), room, cursors[0], cursors[1], limit, loc)
+		}
+	}
+	if errors.Is(err, core.ErrInvalidRoomName) || errors.Is(err, core.ErrInvalidHistoryQuery) {
+		writer.Write(
+			r.Context(),
+			w,
+			err.Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if errors.Is(err, core.ErrRoomNotFound) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Room not found!",
+			http.StatusNotFound,
+		)
+		return
+	}
+	if err != nil {
+		handler.logger.Error(
+			"room manager history",
+			"request_id", requestID,
+			"error", err,
+			"room", room,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Something went wrong on our end!",
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	writer.WriteJSON(
+		r.Context(),
+		w,
+		page,
+		http.StatusOK,
+	)
+}
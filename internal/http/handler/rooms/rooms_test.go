@@ -0,0 +1,84 @@
+package rooms
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/memory"
+	"github.com/dgdraganov/crispy-chat-service/pkg/ratelimit"
+)
+
+func TestListRoomsFiltersByReadPermission(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	chat := core.New(nil, nil, store, nil, store, ratelimit.NewMemory(), core.NewValidationChain(4096), core.NewSystemClock(),
+		core.HubConfig{BufferSize: 16}, core.TokenConfig{},
+		core.ACLConfig{DefaultPermissions: []string{core.PermissionRoomRead, core.PermissionRoomWrite}},
+		core.RateLimitConfig{}, core.PublishConfig{}, logger)
+	for _, room := range []string{"open", "private", "public", "write-only"} {
+		if err := chat.CreateRoom(room); err != nil {
+			t.Fatalf("create room %s: %v", room, err)
+		}
+	}
+	grants := []struct{ room, clientID, permission string }{
+		{"private", "Bob", core.PermissionRoomRead},
+		{"public", core.AnyClient, core.PermissionRoomRead},
+		{"write-only", "Jim", core.PermissionRoomWrite},
+	}
+	for _, grant := range grants {
+		if err := chat.SetGrant(grant.room, grant.clientID, []string{grant.permission}); err != nil {
+			t.Fatalf("set grant in %s: %v", grant.room, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		principal model.Principal
+		want      []string
+	}{
+		{
+			name:      "client",
+			principal: model.Principal{ClientID: "Jim", Scopes: []string{core.ScopeRead}},
+			want:      []string{"open", "public"},
+		},
+		{
+			name:      "granted client",
+			principal: model.Principal{ClientID: "Bob", Scopes: []string{core.ScopeRead}},
+			want:      []string{"open", "private", "public"},
+		},
+		{
+			name:      "rooms admin",
+			principal: model.Principal{ClientID: "admin", Scopes: []string{core.ScopeRead, core.ScopeRoomsAdmin}},
+			want:      []string{"open", "private", "public", "write-only"},
+		},
+	}
+
+	handler := NewHandler("/rooms", chat, 4096, logger)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), model.RequestID, "request")
+			ctx = context.WithValue(ctx, model.PrincipalKey, tt.principal)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rooms", nil).WithContext(ctx))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+			var resp model.RoomsResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if !slices.Equal(resp.Rooms, tt.want) {
+				t.Fatalf("got rooms %v, want %v", resp.Rooms, tt.want)
+			}
+		})
+	}
+}
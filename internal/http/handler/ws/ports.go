@@ -0,0 +1,17 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type Chat interface {
+	CheckRoom(room string) error
+	Authorize(principal model.Principal, room, permission string) error
+	CheckRateLimit(clientID, room, ip string) error
+	Publish(ctx context.Context, clientID, room, messageID, message string, sentAt time.Time) (int64, error)
+	ReadMessages(ctx context.Context, clientID, room string, since int64) (*core.Subscription, error)
+}
@@ -0,0 +1,435 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+	"github.com/gorilla/websocket"
+)
+
+// session serves the frames of a single /ws connection
+type session struct {
+	ctx       context.Context
+	handler   *wsHandler
+	conn      *websocket.Conn
+	principal model.Principal
+	ip        string
+	loc       *time.Location
+	requestID string
+	heartbeat *common.Heartbeat
+
+	// writeMu serializes the writes of the read loop and the subscriptions
+	writeMu sync.Mutex
+
+	// subsMu guards subscriptions, which maps a room to its subscription
+	subsMu        sync.Mutex
+	subscriptions map[string]*core.Subscription
+	wg            sync.WaitGroup
+
+	// violations is the number of messages in a row discarded by the client or IP limit
+	violations int
+}
+
+func newSession(ctx context.Context, handler *wsHandler, conn *websocket.Conn, principal model.Principal, ip string, loc *time.Location) *session {
+	return &session{
+		ctx:           ctx,
+		handler:       handler,
+		conn:          conn,
+		principal:     principal,
+		ip:            ip,
+		loc:           loc,
+		requestID:     ctx.Value(model.RequestID).(string),
+		subscriptions: make(map[string]*core.Subscription),
+	}
+}
+
+// run reads the client frames until the connection or the context is closed
+// and waits for all subscriptions to stop
+func (s *session) run() {
+	s.heartbeat = s.handler.keepalive.Start(s.conn)
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		s.heartbeat.Stop()
+		s.subsMu.Lock()
+		for _, sub := range s.subscriptions {
+			sub.Close()
+		}
+		s.subsMu.Unlock()
+		s.wg.Wait()
+		s.conn.Close()
+	}()
+
+	expiry := common.ExpiryTimer(s.principal.ExpiresAt)
+	defer expiry.Stop()
+
+	// unblock the read loop when the server shuts down, the connection is idle
+	// or the token expires
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			s.disconnect(websocket.CloseGoingAway, "closing connection")
+		case <-s.heartbeat.Idle():
+			s.handler.logger.Info(
+				"closing idle connection",
+				"request_id", s.requestID,
+				"idle_timeout", s.handler.keepalive.IdleTimeout,
+			)
+			s.disconnect(websocket.CloseNormalClosure, "Connection idle for too long!")
+		case <-expiry.C:
+			s.handler.logger.Info(
+				"closing connection of expired token",
+				"request_id", s.requestID,
+				"client_id", s.principal.ClientID,
+			)
+			s.disconnect(websocket.ClosePolicyViolation, "Token expired!")
+		case <-done:
+		}
+	}()
+
+	for {
+		_, b, err := s.conn.ReadMessage()
+		if errors.Is(err, websocket.ErrReadLimit) {
+			s.handler.logger.Warn(
+				"frame exceeds the read limit - closing connection",
+				"request_id", s.requestID,
+				"max_frame_size", s.handler.maxFrameSize,
+			)
+			return
+		}
+		if err != nil {
+			s.handler.logger.Info(
+				"ws connection closed",
+				"request_id", s.requestID,
+				"error", err,
+			)
+			return
+		}
+		s.heartbeat.Touch()
+
+		frame := model.ClientFrame{}
+		if err := json.Unmarshal(b, &frame); err != nil {
+			s.writeError(frame, "invalid_frame", "Invalid JSON frame!")
+			continue
+		}
+		if frame.Room == "" {
+			frame.Room = core.DefaultRoom
+		}
+
+		switch frame.Type {
+		case model.FrameTypeSubscribe:
+			s.subscribe(frame)
+		case model.FrameTypeUnsubscribe:
+			s.unsubscribe(frame)
+		case model.FrameTypePublish:
+			if !s.publish(frame) {
+				return
+			}
+		default:
+			s.writeError(frame, "unknown_type", "Unknown frame type! Supported types are subscribe, unsubscribe and publish")
+		}
+	}
+}
+
+// subscribe starts forwarding the messages of the room to the client
+func (s *session) subscribe(frame model.ClientFrame) {
+	if !s.principal.HasScope(core.ScopeRead) {
+		s.writeError(frame, "forbidden", "Insufficient token scope")
+		return
+	}
+
+	s.subsMu.Lock()
+	_, subscribed := s.subscriptions[frame.Room]
+	s.subsMu.Unlock()
+	if subscribed {
+		s.writeError(frame, "already_subscribed", "Already subscribed to the room!")
+		return
+	}
+
+	if !s.check(frame, core.PermissionRoomRead) {
+		return
+	}
+
+	sub, err := s.handler.chat.ReadMessages(s.ctx, s.principal.ClientID, frame.Room, frame.Since)
+	if err != nil {
+		s.writeRoomError(frame, err)
+		return
+	}
+
+	s.subsMu.Lock()
+	s.subscriptions[frame.Room] = sub
+	s.subsMu.Unlock()
+
+	s.handler.logger.Info(
+		"subscribed to room",
+		"request_id", s.requestID,
+		"client_id", s.principal.ClientID,
+		"room", frame.Room,
+		"since", frame.Since,
+	)
+	s.writeJSON(model.AckFrame{
+		Type: model.FrameTypeAck,
+		ID:   frame.ID,
+		Room: frame.Room,
+	})
+
+	s.wg.Add(1)
+	go s.forward(frame.Room, sub)
+}
+
+// unsubscribe stops forwarding the messages of the room
+func (s *session) unsubscribe(frame model.ClientFrame) {
+	s.subsMu.Lock()
+	sub, ok := s.subscriptions[frame.Room]
+	delete(s.subscriptions, frame.Room)
+	s.subsMu.Unlock()
+
+	if !ok {
+		s.writeError(frame, "not_subscribed", "Not subscribed to the room!")
+		return
+	}
+	sub.Close()
+
+	s.handler.logger.Info(
+		"unsubscribed from room",
+		"request_id", s.requestID,
+		"client_id", s.principal.ClientID,
+		"room", frame.Room,
+	)
+	s.writeJSON(model.AckFrame{
+		Type: model.FrameTypeAck,
+		ID:   frame.ID,
+		Room: frame.Room,
+	})
+}
+
+// forward sends the messages of a subscription to the client until the subscription stops
+func (s *session) forward(room string, sub *core.Subscription) {
+	defer s.wg.Done()
+
+	for frame := range sub.Messages() {
+		msg, err := core.FormatJSON.Render(frame, s.loc)
+		if err != nil {
+			s.handler.logger.Error(
+				"render message failed - discarding message",
+				"request_id", s.requestID,
+				"error", err,
+			)
+			continue
+		}
+		if err := s.write(websocket.TextMessage, msg); err != nil {
+			s.handler.logger.Error(
+				"write message error",
+				"request_id", s.requestID,
+				"error", err,
+			)
+			s.remove(room, sub)
+			return
+		}
+	}
+
+	// the subscription was not closed, the message stream was stopped by the server
+	if err := sub.Err(); errors.Is(err, core.ErrStreamClosed) {
+		s.remove(room, sub)
+
+		s.handler.logger.Warn(
+			"message stream closed",
+			"request_id", s.requestID,
+			"room", room,
+			"error", err,
+		)
+
+		s.writeJSON(model.ErrorFrame{
+			Type:    model.FrameTypeError,
+			Room:    room,
+			Code:    "subscription_closed",
+			Message: "Message stream closed, subscribe again later!",
+		})
+	}
+}
+
+// remove closes the subscription and removes it unless the room was subscribed again meanwhile
+func (s *session) remove(room string, sub *core.Subscription) {
+	s.subsMu.Lock()
+	if s.subscriptions[room] == sub {
+		delete(s.subscriptions, room)
+	}
+	s.subsMu.Unlock()
+	sub.Close()
+}
+
+// publish stores the message and acknowledges it. It returns false when the
+// client was disconnected for exceeding the rate limits too many times.
+func (s *session) publish(frame model.ClientFrame) bool {
+	clientID := s.principal.ClientID
+
+	if !s.principal.HasScope(core.ScopeWrite) {
+		s.writeError(frame, "forbidden", "Insufficient token scope")
+		return true
+	}
+	if !s.check(frame, core.PermissionRoomWrite) {
+		return true
+	}
+
+	err := s.handler.chat.CheckRateLimit(clientID, frame.Room, s.ip)
+	var limitErr *core.RateLimitError
+	if errors.As(err, &limitErr) {
+		// the room limit is shared, only the client's own limits count as violations
+		if limitErr.Violation() {
+			s.violations++
+		}
+		s.handler.logger.Warn(
+			"rate limit exceeded - discarding message",
+			"request_id", s.requestID,
+			"client_id", clientID,
+			"room", frame.Room,
+			"ip", s.ip,
+			"scope", limitErr.Scope,
+			"violations", s.violations,
+		)
+		if s.handler.maxViolations > 0 && s.violations >= s.handler.maxViolations {
+			s.disconnect(websocket.ClosePolicyViolation, "Rate limit exceeded too many times!")
+			return false
+		}
+		s.writeJSON(model.ErrorFrame{
+			Type:       model.FrameTypeError,
+			ID:         frame.ID,
+			Room:       frame.Room,
+			Code:       "rate_limited",
+			Message:    fmt.Sprintf("Too many messages per %s, message discarded!", limitErr.Scope),
+			RetryAfter: limitErr.RetryAfter.Milliseconds(),
+		})
+		return true
+	}
+	if err != nil {
+		// the limits are not enforced while the limiter is unavailable
+		s.handler.logger.Error(
+			"check rate limit failed",
+			"request_id", s.requestID,
+			"error", err,
+		)
+	}
+	s.violations = 0
+
+	var sentAt time.Time
+	if frame.SentAt > 0 {
+		sentAt = time.UnixMilli(frame.SentAt)
+	}
+	cursor, err := s.handler.chat.Publish(s.ctx, clientID, frame.Room, frame.ID, frame.Message, sentAt)
+	var validationErr *core.ValidationError
+	if errors.As(err, &validationErr) {
+		s.writeError(frame, validationErr.Code, fmt.Sprintf("Invalid message, %s!", validationErr.Reason))
+		return true
+	}
+	if err != nil {
+		s.writeRoomError(frame, err)
+		return true
+	}
+
+	s.writeJSON(model.AckFrame{
+		Type:   model.FrameTypeAck,
+		ID:     frame.ID,
+		Room:   frame.Room,
+		Cursor: cursor,
+	})
+	return true
+}
+
+// check verifies that the room exists and the client has the permission in it,
+// otherwise it sends an error frame and returns false
+func (s *session) check(frame model.ClientFrame, permission string) bool {
+	if err := s.handler.chat.CheckRoom(frame.Room); err != nil {
+		s.writeRoomError(frame, err)
+		return false
+	}
+	if err := s.handler.chat.Authorize(s.principal, frame.Room, permission); err != nil {
+		s.writeRoomError(frame, err)
+		return false
+	}
+	return true
+}
+
+// writeRoomError sends the error frame for an error returned by the chat service
+func (s *session) writeRoomError(frame model.ClientFrame, err error) {
+	switch {
+	case errors.Is(err, core.ErrInvalidRoomName):
+		s.writeError(frame, "invalid_room", "Invalid room name!")
+	case errors.Is(err, core.ErrRoomNotFound):
+		s.writeError(frame, "room_not_found", "Room not found!")
+	case errors.Is(err, core.ErrPermissionDenied) && frame.Type == model.FrameTypeSubscribe:
+		s.writeError(frame, "forbidden", "Not allowed to read the room!")
+	case errors.Is(err, core.ErrPermissionDenied):
+		s.writeError(frame, "forbidden", "Not allowed to write to the room!")
+	default:
+		s.handler.logger.Error(
+			"ws frame failed",
+			"request_id", s.requestID,
+			"error", err,
+			"type", frame.Type,
+			"room", frame.Room,
+		)
+		s.writeError(frame, "internal_error", "Something went wrong on our end!")
+	}
+}
+
+func (s *session) writeError(frame model.ClientFrame, code, message string) {
+	s.writeJSON(model.ErrorFrame{
+		Type:    model.FrameTypeError,
+		ID:      frame.ID,
+		Room:    frame.Room,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// writeJSON sends an ack or error frame to the client
+func (s *session) writeJSON(frame any) {
+	b, err := json.Marshal(frame)
+	if err != nil {
+		s.handler.logger.Error(
+			"json marshal frame",
+			"request_id", s.requestID,
+			"error", err,
+		)
+		return
+	}
+	if err := s.write(websocket.TextMessage, b); err != nil {
+		s.handler.logger.Error(
+			"write frame",
+			"request_id", s.requestID,
+			"error", err,
+		)
+	}
+}
+
+func (s *session) write(messageType int, b []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.conn.SetWriteDeadline(s.handler.keepalive.WriteDeadline())
+	if err := s.conn.WriteMessage(messageType, b); err != nil {
+		return err
+	}
+	s.heartbeat.Touch()
+	return nil
+}
+
+// disconnect closes the connection with the close code and reason
+func (s *session) disconnect(closeCode int, reason string) {
+	err := s.write(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, reason))
+	if err != nil {
+		s.handler.logger.Error(
+			"conn writing close message",
+			"request_id", s.requestID,
+			"error", err,
+		)
+	}
+	s.conn.Close()
+}
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+	"github.com/gorilla/websocket"
+)
+
+type wsHandler struct {
+	method string
+	chat   Chat
+	logger *slog.Logger
+	// maxFrameSize is the size in bytes of the largest websocket frame read from the client
+	maxFrameSize int64
+	// maxViolations is the number of rate limited messages in a row after which the client is disconnected
+	maxViolations int
+	// keepalive holds the ping, deadline and idle timeout settings of the connections
+	keepalive common.Keepalive
+}
+
+// NewHandler is a constructor function for the wsHandler type
+func NewHandler(method string, chat Chat, maxFrameSize int64, maxViolations int, keepalive common.Keepalive, logger *slog.Logger) *wsHandler {
+	return &wsHandler{
+		method:        method,
+		chat:          chat,
+		logger:        logger,
+		maxFrameSize:  maxFrameSize,
+		maxViolations: maxViolations,
+		keepalive:     keepalive,
+	}
+}
+
+// ServeHTTP implements the http.Handler interface for the wsHandler type
+func (handler *wsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Context().Value(model.RequestID).(string)
+	principal := r.Context().Value(model.PrincipalKey).(model.Principal)
+
+	writer := common.NewWriter(handler.logger)
+
+	if r.Method != handler.method {
+		handler.logger.Warn(
+			"invalid request method for ws endpoint",
+			"request_method", r.Method,
+			"expected_request_method", handler.method,
+			"request_id", requestID,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			fmt.Sprintf("invalid request method %s, expected method is %s", r.Method, handler.method),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !principal.HasScope(core.ScopeRead) && !principal.HasScope(core.ScopeWrite) {
+		writer.Write(
+			r.Context(),
+			w,
+			"Insufficient token scope",
+			http.StatusForbidden,
+		)
+		return
+	}
+
+	q, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		handler.logger.Error(
+			"url parse query",
+			"request_id", requestID,
+			"error", err,
+		)
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid URL!",
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	loc, err := core.ParseTimezone(q.Get("tz"))
+	if err != nil {
+		writer.Write(
+			r.Context(),
+			w,
+			"Invalid tz! Expected an IANA timezone name, e.g. Europe/Sofia",
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	var upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+
+	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		handler.logger.Error(
+			"upgrade to websocet",
+			"request_id", requestID,
+			"error", err,
+		)
+		return
+	}
+	// a larger frame closes the connection with the close code 1009 (message too big)
+	if handler.maxFrameSize > 0 {
+		conn.SetReadLimit(handler.maxFrameSize)
+	}
+
+	handler.logger.Info(
+		"upgraded to websockets",
+		"request_id", requestID,
+		"client_id", principal.ClientID,
+	)
+
+	ip, _ := r.Context().Value(model.ClientIP).(string)
+	ctx, cancel := context.WithCancel(context.WithValue(r.Context(), model.ClientID, principal.ClientID))
+	defer cancel()
+
+	s := newSession(ctx, handler, conn, principal, ip, loc)
+	s.run()
+}
@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
+	"github.com/dgdraganov/crispy-chat-service/pkg/memory"
+	"github.com/dgdraganov/crispy-chat-service/pkg/ratelimit"
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves the handler on a memory store, every request is made by
+// the principal
+func newTestServer(t *testing.T, principal model.Principal) *httptest.Server {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.New()
+	chat := core.New(nil, nil, store, nil, store, ratelimit.NewMemory(), core.NewValidationChain(4096), core.NewSystemClock(),
+		core.HubConfig{BufferSize: 16}, core.TokenConfig{},
+		core.ACLConfig{DefaultPermissions: []string{core.PermissionRoomRead, core.PermissionRoomWrite}},
+		core.RateLimitConfig{}, core.PublishConfig{}, logger)
+	if err := chat.CreateRoom(core.DefaultRoom); err != nil {
+		t.Fatalf("create default room: %v", err)
+	}
+
+	handler := NewHandler(http.MethodGet, chat, 4096, 0, common.Keepalive{}, logger)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), model.RequestID, "request")
+		ctx = context.WithValue(ctx, model.PrincipalKey, principal)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWSClosesOnTokenExpiry(t *testing.T) {
+	server := newTestServer(t, model.Principal{
+		ClientID:  "Jim",
+		Scopes:    []string{core.ScopeRead, core.ScopeWrite},
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("got error %v, want close code %d", err, websocket.ClosePolicyViolation)
+	}
+}
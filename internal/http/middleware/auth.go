@@ -2,29 +2,143 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 
+	"github.com/dgdraganov/crispy-chat-service/internal/core"
 	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/dgdraganov/crispy-chat-service/pkg/common"
 )
 
-type signatureMiddleware struct {
-	logger *slog.Logger
+// AccessTokenParam is the query parameter and the cookie that carry the access
+// token of Server-Sent Events requests, browsers cannot set the headers of an EventSource
+const AccessTokenParam = "access_token"
+
+type authMiddleware struct {
+	auth Authenticator
+	// queryToken allows Server-Sent Events requests to pass the access token
+	// in the query parameter
+	queryToken bool
+	logger     *slog.Logger
 }
 
-func NewSignatureMiddleware(logger *slog.Logger) *signatureMiddleware {
-	return &signatureMiddleware{
-		logger: logger,
+func NewAuthMiddleware(auth Authenticator, queryToken bool, logger *slog.Logger) *authMiddleware {
+	return &authMiddleware{
+		auth:       auth,
+		queryToken: queryToken,
+		logger:     logger,
 	}
 }
 
-// Auth implements the middleware logic to attach the signature to the request context
-func (r *signatureMiddleware) Auth(handler http.Handler) http.Handler {
+// Token implements the middleware logic to attach the raw access token to the request context
+// without verifying it
+func (a *authMiddleware) Token(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), model.Signature, requestToken(r))
+		r = r.WithContext(ctx)
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Auth implements the middleware logic to verify the access token and attach the
+// principal it was issued to to the request context. Requests without a valid
+// token are rejected.
+func (a *authMiddleware) Auth(handler http.Handler) http.Handler {
+	return a.authenticate(handler, requestToken)
+}
+
+// StreamAuth works like Auth but Server-Sent Events requests may also pass the
+// access token in the access_token cookie or, when allowed, query parameter
+func (a *authMiddleware) StreamAuth(handler http.Handler) http.Handler {
+	return a.authenticate(handler, func(r *http.Request) string {
+		return streamToken(r, a.queryToken)
+	})
+}
+
+// authenticate verifies the access token read from the request with tokenFunc
+func (a *authMiddleware) authenticate(handler http.Handler, tokenFunc func(*http.Request) string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		signature := r.Header.Get("Signature")
-		ctx := context.WithValue(r.Context(), model.Signature, signature)
+		requestID, _ := r.Context().Value(model.RequestID).(string)
+
+		writer := common.NewWriter(a.logger)
+
+		token := tokenFunc(r)
+		if token == "" {
+			writer.Write(
+				r.Context(),
+				w,
+				"Missing access token!",
+				http.StatusUnauthorized,
+			)
+			return
+		}
+
+		principal, err := a.auth.Authenticate(token)
+		if errors.Is(err, core.ErrInvalidToken) || errors.Is(err, core.ErrTokenExpired) {
+			a.logger.Warn(
+				"token rejected",
+				"request_id", requestID,
+				"error", err,
+			)
+			writer.Write(
+				r.Context(),
+				w,
+				"Invalid or expired token",
+				http.StatusUnauthorized,
+			)
+			return
+		}
+		if err != nil {
+			a.logger.Error(
+				"authenticate token",
+				"request_id", requestID,
+				"error", err,
+			)
+			writer.Write(
+				r.Context(),
+				w,
+				"Something went wrong on our end!",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), model.PrincipalKey, principal)
 		r = r.WithContext(ctx)
 
 		handler.ServeHTTP(w, r)
 	})
 }
+
+// requestToken reads the access token from the "Authorization: Bearer" header
+// or the legacy "Signature" header
+func requestToken(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		token = r.Header.Get("Signature")
+	}
+	return token
+}
+
+// streamToken reads the access token the same as requestToken, Server-Sent
+// Events requests without it may pass it in the access_token cookie instead.
+// The query parameter, which leaks into proxy logs and the browser history, is
+// only read without the cookie and when queryToken is set.
+func streamToken(r *http.Request, queryToken bool) string {
+	if token := requestToken(r); token != "" {
+		return token
+	}
+	if !common.AcceptsEventStream(r) {
+		return ""
+	}
+	if cookie, err := r.Cookie(AccessTokenParam); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	if queryToken {
+		return r.URL.Query().Get(AccessTokenParam)
+	}
+	return ""
+}
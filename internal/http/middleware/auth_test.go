@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		header     map[string]string
+		cookie     string
+		queryToken bool
+		want       string
+	}{
+		{
+			name:       "bearer header",
+			url:        "/listen?access_token=query",
+			header:     map[string]string{"Accept": "text/event-stream", "Authorization": "Bearer header"},
+			cookie:     "cookie",
+			queryToken: true,
+			want:       "header",
+		},
+		{
+			name:       "cookie before query parameter",
+			url:        "/listen?access_token=query",
+			header:     map[string]string{"Accept": "text/event-stream"},
+			cookie:     "cookie",
+			queryToken: true,
+			want:       "cookie",
+		},
+		{
+			name:       "query parameter",
+			url:        "/listen?access_token=query",
+			header:     map[string]string{"Accept": "text/event-stream"},
+			queryToken: true,
+			want:       "query",
+		},
+		{
+			name:   "query parameter disabled",
+			url:    "/listen?access_token=query",
+			header: map[string]string{"Accept": "text/event-stream"},
+			want:   "",
+		},
+		{
+			name:   "cookie",
+			url:    "/listen",
+			header: map[string]string{"Accept": "text/html, text/event-stream"},
+			cookie: "cookie",
+			want:   "cookie",
+		},
+		{
+			name:       "not an event stream",
+			url:        "/listen?access_token=query",
+			cookie:     "cookie",
+			queryToken: true,
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for key, value := range tt.header {
+				r.Header.Set(key, value)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: AccessTokenParam, Value: tt.cookie})
+			}
+
+			if got := streamToken(r, tt.queryToken); got != tt.want {
+				t.Fatalf("got token %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "query parameter", url: "/listen?room=general&access_token=secret"},
+		{name: "invalid query", url: "/listen?room=general&access_token=secret;"},
+		{name: "invalid escape", url: "/listen?room=general&access_token=secret%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			raw := r.URL.RawQuery
+
+			redacted := redactURL(r.URL).String()
+			if strings.Contains(redacted, "secret") {
+				t.Fatalf("token not redacted from %s", redacted)
+			}
+			if !strings.Contains(redacted, "room=general") {
+				t.Fatalf("query parameters dropped from %s", redacted)
+			}
+			if r.URL.RawQuery != raw {
+				t.Fatal("request URL modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type clientIPMiddleware struct {
+	header      string
+	trustedHops int
+	logger      *slog.Logger
+}
+
+// NewClientIPMiddleware is a constructor function for the clientIPMiddleware type. When
+// header is set, e.g. "X-Forwarded-For", the client address is taken from it instead of
+// the connection, which is only safe behind a proxy that sets the header. trustedHops is
+// the number of proxies in front of the server that append to the header.
+func NewClientIPMiddleware(header string, trustedHops int, logger *slog.Logger) *clientIPMiddleware {
+	return &clientIPMiddleware{
+		header:      header,
+		trustedHops: max(trustedHops, 1),
+		logger:      logger,
+	}
+}
+
+// IP implements the middleware logic to attach the client's address to the request context
+func (m *clientIPMiddleware) IP(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), model.ClientIP, m.clientIP(r))
+		r = r.WithContext(ctx)
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (m *clientIPMiddleware) clientIP(r *http.Request) string {
+	if m.header != "" {
+		// the client controls the start of the list, only the addresses appended
+		// by the trusted proxies on the right can be relied on
+		var forwarded []string
+		for _, value := range r.Header.Values(m.header) {
+			forwarded = append(forwarded, strings.Split(value, ",")...)
+		}
+		if len(forwarded) > 0 {
+			hop := max(len(forwarded)-m.trustedHops, 0)
+			if ip := strings.TrimSpace(forwarded[hop]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		trustedHops int
+		forwarded   []string
+		want        string
+	}{
+		{
+			name: "connection address",
+			want: "192.0.2.1",
+		},
+		{
+			name:        "header not set",
+			header:      "X-Forwarded-For",
+			trustedHops: 1,
+			want:        "192.0.2.1",
+		},
+		{
+			name:        "address appended by the proxy",
+			header:      "X-Forwarded-For",
+			trustedHops: 1,
+			forwarded:   []string{"203.0.113.7"},
+			want:        "203.0.113.7",
+		},
+		{
+			name:        "spoofed header",
+			header:      "X-Forwarded-For",
+			trustedHops: 1,
+			forwarded:   []string{"198.51.100.1, 198.51.100.2, 203.0.113.7"},
+			want:        "203.0.113.7",
+		},
+		{
+			name:        "spoofed header line",
+			header:      "X-Forwarded-For",
+			trustedHops: 1,
+			forwarded:   []string{"198.51.100.1", "203.0.113.7"},
+			want:        "203.0.113.7",
+		},
+		{
+			name:        "two trusted proxies",
+			header:      "X-Forwarded-For",
+			trustedHops: 2,
+			forwarded:   []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"},
+			want:        "203.0.113.7",
+		},
+		{
+			name:        "fewer addresses than proxies",
+			header:      "X-Forwarded-For",
+			trustedHops: 3,
+			forwarded:   []string{"203.0.113.7, 10.0.0.2"},
+			want:        "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewClientIPMiddleware(tt.header, tt.trustedHops, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := m.clientIP(r); got != tt.want {
+				t.Fatalf("got client IP %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
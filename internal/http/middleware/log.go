@@ -3,6 +3,7 @@ package middleware
 import (
 	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/dgdraganov/crispy-chat-service/internal/model"
 )
@@ -25,9 +26,26 @@ func (l *logMiddleware) Log(handler http.Handler) http.Handler {
 			"incoming request",
 			"method", r.Method,
 			"request_id", requestID,
-			"url", r.URL,
+			"url", redactURL(r.URL),
 		)
 
 		handler.ServeHTTP(w, r)
 	})
 }
+
+// redactURL returns a copy of the URL without the value of the access token
+// query parameter. Queries that cannot be parsed are logged without the
+// invalid parameters, which may hold the token as well.
+func redactURL(u *url.URL) *url.URL {
+	query, err := url.ParseQuery(u.RawQuery)
+	if err == nil && !query.Has(AccessTokenParam) {
+		return u
+	}
+	if query.Has(AccessTokenParam) {
+		query.Set(AccessTokenParam, "REDACTED")
+	}
+
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return &redacted
+}
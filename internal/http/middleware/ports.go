@@ -0,0 +1,7 @@
+package middleware
+
+import "github.com/dgdraganov/crispy-chat-service/internal/model"
+
+type Authenticator interface {
+	Authenticate(token string) (model.Principal, error)
+}
@@ -0,0 +1,7 @@
+package model
+
+// Grant gives a client permissions in a room. The client ID "*" matches every client.
+type Grant struct {
+	ClientID    string   `json:"client_id"`
+	Permissions []string `json:"permissions"`
+}
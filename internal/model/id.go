@@ -6,4 +6,6 @@ const (
 	RequestID contextKey = iota
 	Signature
 	ClientID
+	PrincipalKey
+	ClientIP
 )
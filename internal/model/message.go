@@ -1,7 +1,62 @@
 package model
 
+// ChatMessage is a message as saved in the db store. Timestamp is the time the
+// server received the message and SentAt the optional time the client sent it,
+// both in milliseconds since the Unix epoch.
 type ChatMessage struct {
 	Timestamp int64
+	SentAt    int64 `json:",omitempty"`
 	Message   string
 	ClientID  string
 }
+
+// StoredMessage is a message as read from the db store together with
+// its cursor - a number that is unique and increasing within a room
+type StoredMessage struct {
+	Cursor  int64
+	Message string
+}
+
+const (
+	FrameTypeMessage = "message"
+	FrameTypeError   = "error"
+	FrameTypeAck     = "ack"
+
+	FrameTypeSubscribe   = "subscribe"
+	FrameTypeUnsubscribe = "unsubscribe"
+	FrameTypePublish     = "publish"
+)
+
+// MessageFrame is a message as delivered to listening clients
+type MessageFrame struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	Room      string `json:"room"`
+	ClientID  string `json:"client_id"`
+	Timestamp int64  `json:"timestamp"`
+	SentAt    int64  `json:"sent_at,omitempty"`
+	Time      string `json:"time"`
+	Message   string `json:"message"`
+}
+
+// AckFrame tells a client that its message was stored or, on /ws, that its request succeeded
+type AckFrame struct {
+	Type string `json:"type"`
+	// ID is the client generated ID of the message or request
+	ID   string `json:"id,omitempty"`
+	Room string `json:"room,omitempty"`
+	// Cursor is the cursor of the stored message
+	Cursor int64 `json:"cursor,omitempty"`
+}
+
+// ErrorFrame tells a client why its message was not published or its request failed
+type ErrorFrame struct {
+	Type string `json:"type"`
+	// ID is the client generated ID of the message or request, if known
+	ID      string `json:"id,omitempty"`
+	Room    string `json:"room,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// RetryAfter is the number of milliseconds to wait before pushing again
+	RetryAfter int64 `json:"retry_after,omitempty"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// RateLimit allows Tokens requests per Interval and bursts of up to Tokens
+// requests. The zero value allows everything.
+type RateLimit struct {
+	Tokens   int
+	Interval time.Duration
+}
+
+// RateLimitBucket is the token bucket of a key limited by a rate limit
+type RateLimitBucket struct {
+	Key   string
+	Limit RateLimit
+}
+
+// Disabled reports whether the limit allows everything
+func (limit RateLimit) Disabled() bool {
+	return limit.Tokens <= 0 || limit.Interval <= 0
+}
@@ -1,13 +1,40 @@
 package model
 
 type AuthRequest struct {
-	ClientID string `json:"client_id"`
+	ClientID string   `json:"client_id"`
+	Secret   string   `json:"secret"`
+	Scopes   []string `json:"scopes"`
 }
 type PushRequest struct {
+	// ID is an optional client generated message ID that is returned in the ack or error frame
+	ID       string `json:"id,omitempty"`
 	ClientID string `json:"client_id"`
 	Message  string `json:"message"`
+	SentAt   int64  `json:"sent_at"`
+}
+
+// ClientFrame is a request sent by a client on the multiplexed /ws connection,
+// Type is one of subscribe, unsubscribe or publish
+type ClientFrame struct {
+	Type string `json:"type"`
+	// ID is an optional client generated ID returned in the ack or error frame,
+	// for publish it is the message ID
+	ID   string `json:"id,omitempty"`
+	Room string `json:"room"`
+	// Since is the cursor to resume a subscription after
+	Since   int64  `json:"since,omitempty"`
+	Message string `json:"message,omitempty"`
+	SentAt  int64  `json:"sent_at,omitempty"`
 }
 
 type ListenRequest struct {
 	ClientID string `json:"client_id"`
 }
+
+type RoomRequest struct {
+	Name string `json:"name"`
+}
+
+type GrantRequest struct {
+	Permissions []string `json:"permissions"`
+}
@@ -3,3 +3,35 @@ package model
 type ResponseMessage struct {
 	Message string `json:"message"`
 }
+
+// AuthResponse holds an issued access token, ExpiresAt is in seconds since the Unix epoch
+type AuthResponse struct {
+	Token     string   `json:"token"`
+	ExpiresAt int64    `json:"expires_at"`
+	Scopes    []string `json:"scopes"`
+}
+
+type RoomsResponse struct {
+	Rooms []string `json:"rooms"`
+}
+
+// HistoryPage is a page of stored messages in ascending cursor order. Prev is
+// the cursor to pass as before= for the previous (older) page and Next the
+// cursor to pass as after= for the next (newer) page, they are omitted when
+// there are no such messages.
+type HistoryPage struct {
+	Messages []MessageFrame `json:"messages"`
+	Prev     int64          `json:"prev,omitempty"`
+	Next     int64          `json:"next,omitempty"`
+}
+
+type GrantsResponse struct {
+	Room   string  `json:"room"`
+	Grants []Grant `json:"grants"`
+}
+
+// PublishResponse holds the cursor of a message published through the REST API
+type PublishResponse struct {
+	ID   int64  `json:"id"`
+	Room string `json:"room"`
+}
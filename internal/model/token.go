@@ -0,0 +1,46 @@
+package model
+
+// TokenClaims are the signed contents of an access token, the times are in
+// seconds since the Unix epoch
+type TokenClaims struct {
+	Subject   string   `json:"sub"`
+	Audience  string   `json:"aud"`
+	Scopes    []string `json:"scope"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	// AuthTime is when the client authenticated with its credentials, refreshed
+	// tokens keep the time of the token they replace
+	AuthTime int64 `json:"auth_time,omitempty"`
+}
+
+// Principal is the verified identity of the client making a request
+type Principal struct {
+	ClientID  string
+	Scopes    []string
+	ExpiresAt int64
+}
+
+// HasScope checks whether the principal was granted the scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials are presented by a client to obtain an access token. The secret
+// is an API key, a password or an externally issued token depending on the
+// identity provider.
+type Credentials struct {
+	ClientID string
+	Secret   string
+}
+
+// Identity is a client verified by an identity provider. When Scopes is not
+// empty only these scopes may be granted to the client.
+type Identity struct {
+	ClientID string
+	Scopes   []string
+}
@@ -0,0 +1,21 @@
+package common
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// EventStreamType is the media type of Server-Sent Events
+const EventStreamType = "text/event-stream"
+
+// AcceptsEventStream reports whether the client asked for Server-Sent Events
+func AcceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == EventStreamType {
+			return true
+		}
+	}
+	return false
+}
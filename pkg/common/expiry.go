@@ -0,0 +1,10 @@
+package common
+
+import "time"
+
+// ExpiryTimer returns a timer that fires when a token expiring at expiresAt,
+// in seconds since the Unix epoch, expires. Long-lived connections close when
+// it fires, since the token is only verified when they are opened.
+func ExpiryTimer(expiresAt int64) *time.Timer {
+	return time.NewTimer(time.Until(time.Unix(expiresAt, 0)))
+}
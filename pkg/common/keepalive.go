@@ -0,0 +1,141 @@
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Keepalive holds the liveness settings of websocket connections, a zero
+// duration disables the corresponding check
+type Keepalive struct {
+	// PingInterval is how often a ping is sent to the peer
+	PingInterval time.Duration
+	// PongWait is how long a pong is awaited before the peer is considered dead
+	PongWait time.Duration
+	// WriteWait bounds the time spent writing a single frame
+	WriteWait time.Duration
+	// IdleTimeout is how long the peer of a connection may stay unresponsive,
+	// i.e. send no messages and answer no pings
+	IdleTimeout time.Duration
+}
+
+// WriteDeadline returns the deadline of a write started now, it is the zero
+// time when writes are not bounded
+func (k Keepalive) WriteDeadline() time.Time {
+	if k.WriteWait <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(k.WriteWait)
+}
+
+// Heartbeat pings a websocket connection and tracks its activity until it is stopped
+type Heartbeat struct {
+	conn      *websocket.Conn
+	keepalive Keepalive
+	done      chan struct{}
+	stopOnce  sync.Once
+
+	// idleMu guards idleTimer and expired, they are unused without an idle timeout
+	idleMu    sync.Mutex
+	idleTimer *time.Timer
+	expired   bool
+	idle      chan struct{}
+}
+
+// Start sets the read deadline of the connection, extends it and restarts the
+// idle timeout whenever a pong is received and sends a ping every PingInterval.
+// A peer that stops answering fails the pending read with a timeout error, so
+// the connection must be read for the pongs to be handled. The heartbeat must
+// be stopped once the connection is no longer used.
+func (k Keepalive) Start(conn *websocket.Conn) *Heartbeat {
+	h := &Heartbeat{
+		conn:      conn,
+		keepalive: k,
+		done:      make(chan struct{}),
+	}
+
+	if k.PongWait > 0 {
+		conn.SetReadDeadline(time.Now().Add(k.PongWait))
+	}
+	if k.IdleTimeout > 0 {
+		h.idle = make(chan struct{})
+		h.idleTimer = time.AfterFunc(k.IdleTimeout, h.expire)
+	}
+	// a pong shows that the peer is still there
+	conn.SetPongHandler(func(string) error {
+		h.Touch()
+		if k.PongWait > 0 {
+			return conn.SetReadDeadline(time.Now().Add(k.PongWait))
+		}
+		return nil
+	})
+	if k.PingInterval > 0 {
+		go h.ping()
+	}
+	return h
+}
+
+// Idle returns a channel that is closed once the peer sent no messages and
+// answered no pings for the idle timeout, it is nil without an idle timeout
+func (h *Heartbeat) Idle() <-chan struct{} {
+	return h.idle
+}
+
+// Touch records activity of the peer, e.g. a message it sent or received, and restarts the idle timeout
+func (h *Heartbeat) Touch() {
+	h.idleMu.Lock()
+	defer h.idleMu.Unlock()
+
+	// once expired the connection is being closed
+	if h.idleTimer != nil && !h.expired {
+		h.idleTimer.Reset(h.keepalive.IdleTimeout)
+	}
+}
+
+// Stop stops the pings and the idle timeout
+func (h *Heartbeat) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.done)
+
+		// a stopped heartbeat ignores the later activity
+		h.idleMu.Lock()
+		if h.idleTimer != nil {
+			h.idleTimer.Stop()
+			h.idleTimer = nil
+		}
+		h.idleMu.Unlock()
+	})
+}
+
+// expire closes the idle channel when the idle timeout passes
+func (h *Heartbeat) expire() {
+	h.idleMu.Lock()
+	defer h.idleMu.Unlock()
+
+	if !h.expired {
+		h.expired = true
+		close(h.idle)
+	}
+}
+
+// ping sends a ping every ping interval, a failed ping closes the connection
+// so that the pending read returns
+func (h *Heartbeat) ping() {
+	ticker := time.NewTicker(h.keepalive.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			// WriteControl is safe to call concurrently with the other writes
+			if err := h.conn.WriteControl(websocket.PingMessage, nil, h.keepalive.WriteDeadline()); err != nil {
+				h.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHeartbeatPongsKeepConnectionActive(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   bool
+		wantIdle bool
+	}{
+		{name: "client answers pings", answer: true, wantIdle: false},
+		{name: "client does not answer pings", answer: false, wantIdle: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keepalive := Keepalive{PingInterval: 20 * time.Millisecond, WriteWait: time.Second, IdleTimeout: 200 * time.Millisecond}
+			idle := make(chan bool, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+				if err != nil {
+					t.Errorf("upgrade: %v", err)
+					return
+				}
+				defer conn.Close()
+
+				heartbeat := keepalive.Start(conn)
+				defer heartbeat.Stop()
+				// the pongs are handled while the connection is read
+				go func() {
+					for {
+						if _, _, err := conn.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+
+				select {
+				case <-heartbeat.Idle():
+					idle <- true
+				case <-time.After(500 * time.Millisecond):
+					idle <- false
+				}
+			}))
+			defer server.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+			if tt.answer {
+				// reading answers the pings with pongs
+				go func() {
+					for {
+						if _, _, err := conn.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+			}
+
+			if got := <-idle; got != tt.wantIdle {
+				t.Fatalf("got idle %t, want %t", got, tt.wantIdle)
+			}
+		})
+	}
+}
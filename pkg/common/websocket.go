@@ -0,0 +1,53 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout bounds the time spent sending the close frame of a rejected connection
+const closeTimeout = time.Second * 5
+
+// RejectWebsocket is used by websocket handlers in order to refuse a connection
+// after the handshake with a close frame carrying the code and reason, since
+// browser clients cannot see the HTTP status of a failed handshake. Requests
+// that are not websocket handshakes get the reason and HTTP status instead.
+func (w *writer) RejectWebsocket(ctx context.Context, rw http.ResponseWriter, r *http.Request, closeCode int, reason string, statusCode int) {
+	requestID := ctx.Value(model.RequestID).(string)
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		w.Write(ctx, rw, reason, statusCode)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		w.logger.Error(
+			"upgrade to websocket",
+			"request_id", requestID,
+			"error", err,
+		)
+		return
+	}
+	defer conn.Close()
+
+	err = conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeCode, reason),
+		time.Now().Add(closeTimeout),
+	)
+	if err != nil {
+		w.logger.Error(
+			"write close message",
+			"request_id", requestID,
+			"error", err,
+		)
+	}
+}
@@ -22,12 +22,18 @@ func NewWriter(logger *slog.Logger) *writer {
 // Write is used by http handlers in order to write the specific
 // message and status code to the response writer object
 func (w *writer) Write(ctx context.Context, rw http.ResponseWriter, message string, statusCode int) {
-	requestID := ctx.Value(model.RequestID).(string)
-
 	respMsg := model.ResponseMessage{
 		Message: message,
 	}
-	resp, err := json.Marshal(respMsg)
+	w.WriteJSON(ctx, rw, respMsg, statusCode)
+}
+
+// WriteJSON is used by http handlers in order to write an arbitrary
+// JSON encoded body and status code to the response writer object
+func (w *writer) WriteJSON(ctx context.Context, rw http.ResponseWriter, body any, statusCode int) {
+	requestID := ctx.Value(model.RequestID).(string)
+
+	resp, err := json.Marshal(body)
 	if err != nil {
 		w.logger.Error(
 			"json marshal error",
@@ -44,6 +50,7 @@ func (w *writer) Write(ctx context.Context, rw http.ResponseWriter, message stri
 		}
 		return
 	}
+	rw.Header().Set("Content-Type", "application/json")
 	rw.WriteHeader(statusCode)
 	if _, err := rw.Write(resp); err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
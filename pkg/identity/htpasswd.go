@@ -0,0 +1,115 @@
+package identity
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against for unknown users so they take as long as known ones
+var dummyHash = []byte("$2a$10$DMuksHnAc00GNwhDVshXfu1hc33D2ganWNlZOLl5tWqtoVNcMnHWa")
+
+type htpasswdProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	hashes  map[string][]byte
+	// scopes maps a user to the scopes listed in its entry, if any
+	scopes map[string][]string
+}
+
+// NewHtpasswd is a constructor function for the htpasswdProvider type. The file
+// holds one "user:bcrypt-hash" entry per line, as generated by "htpasswd -B",
+// optionally followed by ":scopes" with the space separated scopes of the user.
+// It is reloaded whenever it changes.
+func NewHtpasswd(path string) (*htpasswdProvider, error) {
+	provider := &htpasswdProvider{
+		path: path,
+	}
+	if err := provider.reload(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// Identify checks the password in the credentials secret against the client's bcrypt hash
+func (provider *htpasswdProvider) Identify(ctx context.Context, credentials model.Credentials) (model.Identity, bool, error) {
+	if err := provider.reload(); err != nil {
+		return model.Identity{}, false, err
+	}
+
+	provider.mu.Lock()
+	hash, ok := provider.hashes[credentials.ClientID]
+	scopes := provider.scopes[credentials.ClientID]
+	provider.mu.Unlock()
+
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(credentials.Secret))
+		return model.Identity{}, false, nil
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(credentials.Secret)); err != nil {
+		return model.Identity{}, false, nil
+	}
+
+	return model.Identity{ClientID: credentials.ClientID, Scopes: scopes}, true, nil
+}
+
+// reload reads the file again if it was modified since it was last read
+func (provider *htpasswdProvider) reload() error {
+	info, err := os.Stat(provider.path)
+	if err != nil {
+		return fmt.Errorf("os stat: %w", err)
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if info.ModTime().Equal(provider.modTime) && provider.hashes != nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(provider.path)
+	if err != nil {
+		return fmt.Errorf("os read file: %w", err)
+	}
+
+	hashes := make(map[string][]byte)
+	scopes := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		// bcrypt hashes contain no colons, the scopes do, e.g. chat:read
+		fields := strings.SplitN(entry, ":", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			return fmt.Errorf("htpasswd line %d: missing user", line)
+		}
+		user, hash := fields[0], fields[1]
+		if len(fields) == 3 {
+			scopes[user] = strings.Fields(fields[2])
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("htpasswd line %d: only bcrypt hashes are supported: %w", line, err)
+		}
+		hashes[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan htpasswd: %w", err)
+	}
+
+	provider.hashes = hashes
+	provider.scopes = scopes
+	provider.modTime = info.ModTime()
+	return nil
+}
@@ -0,0 +1,152 @@
+package identity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt hash: %v", err)
+	}
+	return string(hash)
+}
+
+func writeHtpasswd(t *testing.T, path string, lines ...string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("write htpasswd file: %v", err)
+	}
+}
+
+func TestHtpasswdIdentify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path,
+		"# chat clients",
+		"",
+		"Jim:"+bcryptHash(t, "jim-password"),
+		"admin:"+bcryptHash(t, "admin-password")+":chat:read rooms:admin",
+	)
+	provider, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatalf("new htpasswd provider: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		credentials model.Credentials
+		want        model.Identity
+		wantOK      bool
+	}{
+		{
+			name:        "password",
+			credentials: model.Credentials{ClientID: "Jim", Secret: "jim-password"},
+			want:        model.Identity{ClientID: "Jim"},
+			wantOK:      true,
+		},
+		{
+			name:        "password of a user with scopes",
+			credentials: model.Credentials{ClientID: "admin", Secret: "admin-password"},
+			want:        model.Identity{ClientID: "admin", Scopes: []string{"chat:read", "rooms:admin"}},
+			wantOK:      true,
+		},
+		{
+			name:        "wrong password",
+			credentials: model.Credentials{ClientID: "Jim", Secret: "admin-password"},
+		},
+		{
+			name:        "unknown user",
+			credentials: model.Credentials{ClientID: "Ann", Secret: "jim-password"},
+		},
+		{
+			name:        "missing user",
+			credentials: model.Credentials{Secret: "jim-password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, ok, err := provider.Identify(context.Background(), tt.credentials)
+			if err != nil {
+				t.Fatalf("identify: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("got identified %t, want %t", ok, tt.wantOK)
+			}
+			if identity.ClientID != tt.want.ClientID || !slices.Equal(identity.Scopes, tt.want.Scopes) {
+				t.Fatalf("got identity %+v, want %+v", identity, tt.want)
+			}
+		})
+	}
+}
+
+func TestHtpasswdParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "missing hash", line: "Jim"},
+		{name: "missing user", line: ":" + bcryptHash(t, "password")},
+		{name: "not a bcrypt hash", line: "Jim:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "htpasswd")
+			writeHtpasswd(t, path, tt.line)
+
+			if _, err := NewHtpasswd(path); err == nil {
+				t.Fatalf("line %q accepted", tt.line)
+			}
+		})
+	}
+}
+
+func TestHtpasswdReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path, "Jim:"+bcryptHash(t, "old-password"))
+	provider, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatalf("new htpasswd provider: %v", err)
+	}
+
+	writeHtpasswd(t, path, "Jim:"+bcryptHash(t, "new-password")+":chat:read")
+	// the file is read again only when its modification time changes
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("change file times: %v", err)
+	}
+
+	if _, ok, err := provider.Identify(context.Background(), model.Credentials{ClientID: "Jim", Secret: "old-password"}); err != nil || ok {
+		t.Fatalf("old password: got identified %t and error %v, want false and none", ok, err)
+	}
+	identity, ok, err := provider.Identify(context.Background(), model.Credentials{ClientID: "Jim", Secret: "new-password"})
+	if err != nil || !ok {
+		t.Fatalf("new password: got identified %t and error %v, want true and none", ok, err)
+	}
+	if !slices.Equal(identity.Scopes, []string{"chat:read"}) {
+		t.Fatalf("got scopes %v, want [chat:read]", identity.Scopes)
+	}
+
+	// a broken file keeps failing instead of serving stale entries
+	writeHtpasswd(t, path, "Jim")
+	modTime = modTime.Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("change file times: %v", err)
+	}
+	if _, _, err := provider.Identify(context.Background(), model.Credentials{ClientID: "Jim", Secret: "new-password"}); err == nil {
+		t.Fatal("broken file accepted")
+	}
+}
@@ -0,0 +1,91 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type introspectionProvider struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+}
+
+// introspectionResponse is the subset of an RFC 7662 token introspection response the provider uses
+type introspectionResponse struct {
+	Active   bool   `json:"active"`
+	Subject  string `json:"sub"`
+	Username string `json:"username"`
+	Scope    string `json:"scope"`
+}
+
+// NewIntrospection is a constructor function for the introspectionProvider type. The
+// endpoint is an OAuth 2.0 token introspection endpoint (RFC 7662), the clientID and
+// clientSecret authenticate this service to it.
+func NewIntrospection(endpoint, clientID, clientSecret string, client *http.Client) *introspectionProvider {
+	return &introspectionProvider{
+		endpoint:     endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+	}
+}
+
+// Identify asks the introspection endpoint about the token in the credentials secret. The
+// token's subject becomes the client ID and its scopes limit the scopes that can be granted.
+func (provider *introspectionProvider) Identify(ctx context.Context, credentials model.Credentials) (model.Identity, bool, error) {
+	if credentials.Secret == "" {
+		return model.Identity{}, false, nil
+	}
+
+	form := url.Values{}
+	form.Set("token", credentials.Secret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return model.Identity{}, false, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if provider.clientID != "" {
+		req.SetBasicAuth(provider.clientID, provider.clientSecret)
+	}
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return model.Identity{}, false, fmt.Errorf("introspection request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.Identity{}, false, fmt.Errorf("introspection request: unexpected status %s", resp.Status)
+	}
+
+	introspection := introspectionResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return model.Identity{}, false, fmt.Errorf("json decode: %w", err)
+	}
+	if !introspection.Active {
+		return model.Identity{}, false, nil
+	}
+
+	clientID := introspection.Subject
+	if clientID == "" {
+		clientID = introspection.Username
+	}
+	if clientID == "" || (credentials.ClientID != "" && credentials.ClientID != clientID) {
+		return model.Identity{}, false, nil
+	}
+
+	return model.Identity{
+		ClientID: clientID,
+		Scopes:   strings.Fields(introspection.Scope),
+	}, true, nil
+}
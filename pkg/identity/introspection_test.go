@@ -0,0 +1,136 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// newIntrospectionStub serves an introspection endpoint that answers per token
+func newIntrospectionStub(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "chat" || clientSecret != "chat-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch r.FormValue("token") {
+		case "active":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "Jim", "scope": "chat:read rooms:admin"})
+		case "username":
+			json.NewEncoder(w).Encode(map[string]any{"active": true, "username": "Ann"})
+		case "no-subject":
+			json.NewEncoder(w).Encode(map[string]any{"active": true})
+		case "malformed":
+			w.Write([]byte("{"))
+		case "failing":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"active": false})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIntrospectionIdentify(t *testing.T) {
+	server := newIntrospectionStub(t)
+
+	tests := []struct {
+		name         string
+		clientSecret string
+		credentials  model.Credentials
+		want         model.Identity
+		wantOK       bool
+		wantErr      bool
+	}{
+		{
+			name:         "active token",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{Secret: "active"},
+			want:         model.Identity{ClientID: "Jim", Scopes: []string{"chat:read", "rooms:admin"}},
+			wantOK:       true,
+		},
+		{
+			name:         "active token of the named client",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{ClientID: "Jim", Secret: "active"},
+			want:         model.Identity{ClientID: "Jim", Scopes: []string{"chat:read", "rooms:admin"}},
+			wantOK:       true,
+		},
+		{
+			name:         "username without subject",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{Secret: "username"},
+			want:         model.Identity{ClientID: "Ann", Scopes: []string{}},
+			wantOK:       true,
+		},
+		{
+			name:         "active token of another client",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{ClientID: "Ann", Secret: "active"},
+		},
+		{
+			name:         "active token without subject",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{Secret: "no-subject"},
+		},
+		{
+			name:         "inactive token",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{Secret: "revoked"},
+		},
+		{
+			name:         "missing token",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{},
+		},
+		{
+			name:         "endpoint error",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{Secret: "failing"},
+			wantErr:      true,
+		},
+		{
+			name:         "malformed response",
+			clientSecret: "chat-secret",
+			credentials:  model.Credentials{Secret: "malformed"},
+			wantErr:      true,
+		},
+		{
+			name:         "rejected service credentials",
+			clientSecret: "wrong",
+			credentials:  model.Credentials{Secret: "active"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewIntrospection(server.URL, "chat", tt.clientSecret, server.Client())
+
+			identity, ok, err := provider.Identify(context.Background(), tt.credentials)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("got identified %t, want %t", ok, tt.wantOK)
+			}
+			if identity.ClientID != tt.want.ClientID || !slices.Equal(identity.Scopes, tt.want.Scopes) {
+				t.Fatalf("got identity %+v, want %+v", identity, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+type staticProvider struct {
+	// keys maps an API key to the identity it belongs to
+	keys map[string]model.Identity
+}
+
+// NewStatic is a constructor function for the staticProvider type. The keys
+// map an API key to the identity of the client, including its scopes if any.
+func NewStatic(keys map[string]model.Identity) *staticProvider {
+	return &staticProvider{
+		keys: keys,
+	}
+}
+
+// Identify looks up the client the API key in the credentials secret belongs to.
+// When the credentials name a client ID it must match the key's client.
+func (provider *staticProvider) Identify(ctx context.Context, credentials model.Credentials) (model.Identity, bool, error) {
+	var identity model.Identity
+	found := false
+	// compare every key in constant time so the response time does not leak valid keys
+	for key, keyIdentity := range provider.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(credentials.Secret)) == 1 {
+			identity = keyIdentity
+			found = true
+		}
+	}
+	if !found || credentials.Secret == "" {
+		return model.Identity{}, false, nil
+	}
+	if credentials.ClientID != "" && credentials.ClientID != identity.ClientID {
+		return model.Identity{}, false, nil
+	}
+
+	return identity, true, nil
+}
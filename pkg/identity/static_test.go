@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+func TestStaticIdentify(t *testing.T) {
+	provider := NewStatic(map[string]model.Identity{
+		"k1": {ClientID: "Jim"},
+		"k2": {ClientID: "admin", Scopes: []string{"chat:read", "rooms:admin"}},
+	})
+
+	tests := []struct {
+		name        string
+		credentials model.Credentials
+		want        model.Identity
+		wantOK      bool
+	}{
+		{
+			name:        "api key",
+			credentials: model.Credentials{Secret: "k1"},
+			want:        model.Identity{ClientID: "Jim"},
+			wantOK:      true,
+		},
+		{
+			name:        "api key with scopes",
+			credentials: model.Credentials{ClientID: "admin", Secret: "k2"},
+			want:        model.Identity{ClientID: "admin", Scopes: []string{"chat:read", "rooms:admin"}},
+			wantOK:      true,
+		},
+		{
+			name:        "api key of another client",
+			credentials: model.Credentials{ClientID: "admin", Secret: "k1"},
+		},
+		{
+			name:        "unknown api key",
+			credentials: model.Credentials{Secret: "k3"},
+		},
+		{
+			name:        "missing api key",
+			credentials: model.Credentials{ClientID: "Jim"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, ok, err := provider.Identify(context.Background(), tt.credentials)
+			if err != nil {
+				t.Fatalf("identify: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("got identified %t, want %t", ok, tt.wantOK)
+			}
+			if identity.ClientID != tt.want.ClientID || !slices.Equal(identity.Scopes, tt.want.Scopes) {
+				t.Fatalf("got identity %+v, want %+v", identity, tt.want)
+			}
+		})
+	}
+}
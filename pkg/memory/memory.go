@@ -0,0 +1,348 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// ErrRoomDeleted is sent to the readers of a room when the room is deleted
+var ErrRoomDeleted error = errors.New("room deleted")
+
+type memoryStore struct {
+	mu    sync.Mutex
+	rooms map[string]struct{}
+	logs  map[string]*roomLog
+	// created is closed and replaced whenever a room log is created
+	created chan struct{}
+	// grants maps a room to the permissions of each client in it
+	grants map[string]map[string][]string
+}
+
+// roomLog holds the messages of a room ordered by cursor
+type roomLog struct {
+	messages []model.StoredMessage
+	// updated is closed and replaced whenever a message is added or the log is deleted
+	updated chan struct{}
+	deleted bool
+	// published maps a deduplication key to the message stored with it,
+	// keys are kept in publish order so that the expired ones can be dropped
+	published map[string]publishedMessage
+	keys      []string
+}
+
+// publishedMessage is the message a deduplication key was published with
+type publishedMessage struct {
+	cursor  int64
+	expires time.Time
+}
+
+// New is a constructor function for the memoryStore type. The store keeps
+// everything in process memory and is meant for tests and single node setups.
+func New() *memoryStore {
+	return &memoryStore{
+		rooms:   make(map[string]struct{}),
+		logs:    make(map[string]*roomLog),
+		created: make(chan struct{}),
+		grants:  make(map[string]map[string][]string),
+	}
+}
+
+// PublishMessage saves a message and wakes up all readers of the room. The
+// returned value is the message cursor - the requested sortKey unless another
+// message already took it, in which case the next free cursor is used.
+func (store *memoryStore) PublishMessage(room string, sortKey float64, message any) (int64, error) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("json marshal: %w", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.append(store.log(room), sortKey, messageBytes), nil
+}
+
+// PublishUniqueMessage saves a message unless a message with the same key was
+// published to the room within the window. It returns the cursor of the stored
+// message and true when the message is a duplicate and was not saved again.
+func (store *memoryStore) PublishUniqueMessage(room, key string, window time.Duration, sortKey float64, message any) (int64, bool, error) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return 0, false, fmt.Errorf("json marshal: %w", err)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	log := store.log(room)
+	log.dropExpired(now)
+	if published, ok := log.published[key]; ok {
+		return published.cursor, true, nil
+	}
+
+	cursor := store.append(log, sortKey, messageBytes)
+	log.published[key] = publishedMessage{cursor: cursor, expires: now.Add(window)}
+	log.keys = append(log.keys, key)
+
+	return cursor, false, nil
+}
+
+// append adds a message to the room log and wakes up its readers, the caller must hold the lock
+func (store *memoryStore) append(log *roomLog, sortKey float64, message []byte) int64 {
+	cursor := int64(sortKey)
+	if n := len(log.messages); n > 0 && log.messages[n-1].Cursor >= cursor {
+		cursor = log.messages[n-1].Cursor + 1
+	}
+	log.messages = append(log.messages, model.StoredMessage{Cursor: cursor, Message: string(message)})
+
+	close(log.updated)
+	log.updated = make(chan struct{})
+
+	return cursor
+}
+
+// ReadMessages sends all messages stored in the room after the since cursor
+// and then every new message as soon as it is published. When the room is
+// deleted ErrRoomDeleted is sent and both channels are closed.
+func (store *memoryStore) ReadMessages(ctx context.Context, room string, since int64) (<-chan model.StoredMessage, <-chan error) {
+	msgsChan := make(chan model.StoredMessage)
+	errorsChan := make(chan error)
+
+	go func() {
+		defer close(msgsChan)
+		defer close(errorsChan)
+
+		// log stays nil until the first message of an unknown room is published
+		var log *roomLog
+		for {
+			store.mu.Lock()
+			if log == nil {
+				log = store.logs[room]
+			}
+			if log == nil {
+				created := store.created
+				store.mu.Unlock()
+
+				select {
+				case <-created:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			if log.deleted {
+				store.mu.Unlock()
+
+				select {
+				case errorsChan <- fmt.Errorf("room %q: %w", room, ErrRoomDeleted):
+				case <-ctx.Done():
+				}
+				return
+			}
+			pending := log.messages[firstAfter(log.messages, since):]
+			updated := log.updated
+			store.mu.Unlock()
+
+			for _, msg := range pending {
+				select {
+				case msgsChan <- msg:
+					since = msg.Cursor
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-updated:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return msgsChan, errorsChan
+}
+
+// ReadRange reads up to limit messages with cursors between after and before
+// (both exclusive, 0 means unbounded) in ascending cursor order. When newest is
+// set the messages closest to before are returned, otherwise the ones closest
+// to after. A limit of 0 or less returns no messages.
+func (store *memoryStore) ReadRange(room string, after, before int64, limit int64, newest bool) ([]model.StoredMessage, error) {
+	if limit <= 0 {
+		return []model.StoredMessage{}, nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var messages []model.StoredMessage
+	if log, ok := store.logs[room]; ok {
+		messages = log.messages
+	}
+	start := 0
+	if after > 0 {
+		start = firstAfter(messages, after)
+	}
+	end := len(messages)
+	if before > 0 {
+		end = sort.Search(len(messages), func(i int) bool {
+			return messages[i].Cursor >= before
+		})
+	}
+	if start >= end {
+		return []model.StoredMessage{}, nil
+	}
+
+	if int64(end-start) > limit {
+		if newest {
+			start = end - int(limit)
+		} else {
+			end = start + int(limit)
+		}
+	}
+
+	page := make([]model.StoredMessage, end-start)
+	copy(page, messages[start:end])
+	return page, nil
+}
+
+// CreateRoom registers the room together with its message log; it returns
+// false if the room already exists
+func (store *memoryStore) CreateRoom(room string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.rooms[room]; ok {
+		return false, nil
+	}
+	store.rooms[room] = struct{}{}
+	store.log(room)
+	return true, nil
+}
+
+// DeleteRoom removes the room together with its messages and grants and ends
+// the readers of the room; it returns false if the room does not exist
+func (store *memoryStore) DeleteRoom(room string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.rooms[room]; !ok {
+		return false, nil
+	}
+	delete(store.rooms, room)
+	delete(store.grants, room)
+	if log, ok := store.logs[room]; ok {
+		delete(store.logs, room)
+		log.deleted = true
+		close(log.updated)
+	}
+	return true, nil
+}
+
+// ListRooms returns the names of all registered rooms in alphabetical order
+func (store *memoryStore) ListRooms() ([]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	rooms := make([]string, 0, len(store.rooms))
+	for room := range store.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms, nil
+}
+
+// RoomExists checks whether the room is registered
+func (store *memoryStore) RoomExists(room string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	_, ok := store.rooms[room]
+	return ok, nil
+}
+
+// Grants returns the grants of the room
+func (store *memoryStore) Grants(room string) ([]model.Grant, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	grants := make([]model.Grant, 0, len(store.grants[room]))
+	for clientID, permissions := range store.grants[room] {
+		grants = append(grants, model.Grant{
+			ClientID:    clientID,
+			Permissions: append([]string(nil), permissions...),
+		})
+	}
+	return grants, nil
+}
+
+// SetGrant replaces the permissions of the grant's client in the room
+func (store *memoryStore) SetGrant(room string, grant model.Grant) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.grants[room]; !ok {
+		store.grants[room] = make(map[string][]string)
+	}
+	store.grants[room][grant.ClientID] = append([]string(nil), grant.Permissions...)
+	return nil
+}
+
+// DeleteGrant removes the client's grant in the room; it returns false if there is none
+func (store *memoryStore) DeleteGrant(room, clientID string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.grants[room][clientID]; !ok {
+		return false, nil
+	}
+	delete(store.grants[room], clientID)
+	if len(store.grants[room]) == 0 {
+		delete(store.grants, room)
+	}
+	return true, nil
+}
+
+// log returns the room's message log and creates it if needed, it must be
+// called with store.mu held and only from the write paths
+func (store *memoryStore) log(room string) *roomLog {
+	log, ok := store.logs[room]
+	if !ok {
+		log = &roomLog{
+			updated:   make(chan struct{}),
+			published: make(map[string]publishedMessage),
+		}
+		store.logs[room] = log
+
+		close(store.created)
+		store.created = make(chan struct{})
+	}
+	return log
+}
+
+// dropExpired forgets the deduplication keys whose window has passed
+func (log *roomLog) dropExpired(now time.Time) {
+	for len(log.keys) > 0 {
+		published, ok := log.published[log.keys[0]]
+		if ok && published.expires.After(now) {
+			return
+		}
+		delete(log.published, log.keys[0])
+		log.keys = log.keys[1:]
+	}
+}
+
+// firstAfter returns the index of the first message with a cursor greater than since
+func firstAfter(messages []model.StoredMessage, since int64) int {
+	return sort.Search(len(messages), func(i int) bool {
+		return messages[i].Cursor > since
+	})
+}
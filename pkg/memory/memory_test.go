@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitGoroutines fails the test unless the number of goroutines drops back to the baseline
+func waitGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, want at most %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeleteRoomEndsReaders(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	store := New()
+	if _, err := store.CreateRoom("room"); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	if _, err := store.PublishMessage("room", 1, "hello"); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+
+	messages, errs := store.ReadMessages(context.Background(), "room", 0)
+	select {
+	case msg := <-messages:
+		if msg.Cursor != 1 {
+			t.Fatalf("got cursor %d, want 1", msg.Cursor)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stored message not read")
+	}
+
+	if _, err := store.DeleteRoom("room"); err != nil {
+		t.Fatalf("delete room: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrRoomDeleted) {
+			t.Fatalf("got error %v, want %v", err, ErrRoomDeleted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader not ended after the room was deleted")
+	}
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatal("message read after the room was deleted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("messages channel not closed after the room was deleted")
+	}
+	waitGoroutines(t, baseline)
+}
+
+func TestReadPathsDoNotCreateLogs(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	store := New()
+
+	page, err := store.ReadRange("room", 0, 0, 10, false)
+	if err != nil {
+		t.Fatalf("read range: %v", err)
+	}
+	if len(page) != 0 {
+		t.Fatalf("got %d messages, want none", len(page))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, _ := store.ReadMessages(ctx, "room", 0)
+
+	store.mu.Lock()
+	_, ok := store.logs["room"]
+	store.mu.Unlock()
+	if ok {
+		t.Fatal("read paths created the room log")
+	}
+
+	// a reader of a room without messages picks up the first published one
+	if _, err := store.PublishMessage("room", 5, "hello"); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if msg.Cursor != 5 {
+			t.Fatalf("got cursor %d, want 5", msg.Cursor)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("published message not read")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatal("message read after the context was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("messages channel not closed after the context was cancelled")
+	}
+	waitGoroutines(t, baseline)
+}
+
+func TestReadMessagesDroppedConsumer(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	store := New()
+	if _, err := store.CreateRoom("room"); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+
+	// the reader blocks sending a message nobody receives until the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, errs := store.ReadMessages(ctx, "room", 0)
+	if _, err := store.PublishMessage("room", 1, "hello"); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+	// give the reader time to block on the message
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	waitGoroutines(t, baseline)
+	if _, ok := <-messages; ok {
+		t.Fatal("messages channel not closed after the context was cancelled")
+	}
+	if _, ok := <-errs; ok {
+		t.Fatal("errors channel not closed after the context was cancelled")
+	}
+}
+
+func TestReadRangeLimit(t *testing.T) {
+	store := New()
+	for _, cursor := range []int64{1, 2, 3} {
+		if _, err := store.PublishMessage("room", float64(cursor), "hello"); err != nil {
+			t.Fatalf("publish message: %v", err)
+		}
+	}
+
+	for _, limit := range []int64{0, -1} {
+		page, err := store.ReadRange("room", 0, 0, limit, false)
+		if err != nil {
+			t.Fatalf("read range: %v", err)
+		}
+		if len(page) != 0 {
+			t.Fatalf("got %d messages with limit %d, want none", len(page), limit)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// document is the format of the policy file:
+//
+//	{
+//	  "rooms": {
+//	    "announcements": [
+//	      {"client_id": "*", "permissions": ["room:read"]},
+//	      {"client_id": "release-bot", "permissions": ["room:write"]}
+//	    ]
+//	  }
+//	}
+type document struct {
+	Rooms map[string][]model.Grant `json:"rooms"`
+}
+
+type filePolicy struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	rooms   map[string][]model.Grant
+}
+
+// NewFile is a constructor function for the filePolicy type. The file holds the
+// grants of each room as JSON and is reloaded whenever it changes.
+func NewFile(path string) (*filePolicy, error) {
+	policy := &filePolicy{
+		path: path,
+	}
+	if err := policy.reload(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Grants returns the grants of the room
+func (policy *filePolicy) Grants(room string) ([]model.Grant, error) {
+	if err := policy.reload(); err != nil {
+		return nil, err
+	}
+
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	grants := make([]model.Grant, len(policy.rooms[room]))
+	copy(grants, policy.rooms[room])
+	return grants, nil
+}
+
+// reload reads the file again if it was modified since it was last read
+func (policy *filePolicy) reload() error {
+	info, err := os.Stat(policy.path)
+	if err != nil {
+		return fmt.Errorf("os stat: %w", err)
+	}
+
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	if info.ModTime().Equal(policy.modTime) && policy.rooms != nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(policy.path)
+	if err != nil {
+		return fmt.Errorf("os read file: %w", err)
+	}
+
+	doc := document{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("json unmarshal policy: %w", err)
+	}
+	if doc.Rooms == nil {
+		doc.Rooms = make(map[string][]model.Grant)
+	}
+	for room, grants := range doc.Rooms {
+		for _, grant := range grants {
+			if grant.ClientID == "" {
+				return fmt.Errorf("room %q: grant without client_id", room)
+			}
+		}
+	}
+
+	policy.rooms = doc.Rooms
+	policy.modTime = info.ModTime()
+	return nil
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+// sweepInterval is how often buckets that have filled up again are removed
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket is full again if no tokens are taken
+	full time.Time
+}
+
+type memoryLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemory is a constructor function for the memoryLimiter type. The buckets
+// are kept in process memory, so every server instance limits on its own.
+func NewMemory() *memoryLimiter {
+	return &memoryLimiter{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from every bucket, or from none of them when one of
+// the buckets is empty. It returns -1 when the tokens were taken, otherwise
+// the index of the first empty bucket and the time until it has a token.
+func (limiter *memoryLimiter) Allow(buckets []model.RateLimitBucket) (int, time.Duration, error) {
+	now := limiter.now()
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.sweep(now)
+
+	refilled := make([]*bucket, len(buckets))
+	for i, rb := range buckets {
+		b := limiter.refill(rb.Key, rb.Limit, now)
+		if b.tokens < 1 {
+			retryAfter := time.Duration((1 - b.tokens) * float64(perToken(rb.Limit)))
+			return i, retryAfter, nil
+		}
+		refilled[i] = b
+	}
+
+	for i, b := range refilled {
+		b.tokens--
+		capacity := float64(buckets[i].Limit.Tokens)
+		b.full = now.Add(time.Duration((capacity - b.tokens) * float64(perToken(buckets[i].Limit))))
+	}
+	return -1, 0, nil
+}
+
+// refill adds the tokens earned since the last update to the key's bucket and
+// returns it, must be called with limiter.mu held
+func (limiter *memoryLimiter) refill(key string, limit model.RateLimit, now time.Time) *bucket {
+	capacity := float64(limit.Tokens)
+
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now, full: now}
+		limiter.buckets[key] = b
+	}
+
+	b.tokens += float64(now.Sub(b.updated)) / float64(perToken(limit))
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.updated = now
+	return b
+}
+
+// perToken is the time it takes the bucket of the limit to earn a token
+func perToken(limit model.RateLimit) time.Duration {
+	return limit.Interval / time.Duration(limit.Tokens)
+}
+
+// sweep removes the buckets that are full again, must be called with limiter.mu held
+func (limiter *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+
+	for key, b := range limiter.buckets {
+		if now.After(b.full) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
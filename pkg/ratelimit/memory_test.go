@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+func TestMemoryAllowTakesAllOrNothing(t *testing.T) {
+	now := time.Unix(1718000000, 0)
+	limiter := NewMemory()
+	limiter.now = func() time.Time { return now }
+
+	client := model.RateLimitBucket{Key: "client:Jim", Limit: model.RateLimit{Tokens: 2, Interval: time.Second}}
+	room := model.RateLimitBucket{Key: "room:general", Limit: model.RateLimit{Tokens: 1, Interval: time.Second}}
+	otherRoom := model.RateLimitBucket{Key: "room:random", Limit: model.RateLimit{Tokens: 1, Interval: time.Second}}
+
+	if empty, _, err := limiter.Allow([]model.RateLimitBucket{client, room}); err != nil || empty != -1 {
+		t.Fatalf("first message: got empty bucket %d and error %v, want -1 and none", empty, err)
+	}
+
+	// the room is empty now, the rejected message must not take the client's last token
+	empty, retryAfter, err := limiter.Allow([]model.RateLimitBucket{client, room})
+	if err != nil {
+		t.Fatalf("second message: %v", err)
+	}
+	if empty != 1 {
+		t.Fatalf("second message: got empty bucket %d, want 1", empty)
+	}
+	if retryAfter != time.Second {
+		t.Fatalf("second message: got retry after %s, want %s", retryAfter, time.Second)
+	}
+
+	if empty, _, err := limiter.Allow([]model.RateLimitBucket{client, otherRoom}); err != nil || empty != -1 {
+		t.Fatalf("message to another room: got empty bucket %d and error %v, want -1 and none", empty, err)
+	}
+	if empty, _, err := limiter.Allow([]model.RateLimitBucket{client}); err != nil || empty != 0 {
+		t.Fatalf("third message: got empty bucket %d and error %v, want 0 and none", empty, err)
+	}
+
+	now = now.Add(time.Second)
+	if empty, _, err := limiter.Allow([]model.RateLimitBucket{client, room}); err != nil || empty != -1 {
+		t.Fatalf("message after refill: got empty bucket %d and error %v, want -1 and none", empty, err)
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	"github.com/go-redis/redis"
+)
+
+// keyPrefix is put in front of every bucket key
+const keyPrefix = "chat:ratelimit:"
+
+// allowScript refills the buckets for the time passed since their last update
+// and takes a token from each of them, or from none when one of them is empty.
+// The redis server time is used so that all instances agree on the time. It
+// returns {index of the first empty bucket or 0, milliseconds until it has a token}.
+//
+// KEYS - the bucket hashes
+// ARGV - for every bucket its capacity followed by the interval in milliseconds in which it refills
+var allowScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tokens = {}
+for i, key in ipairs(KEYS) do
+	local capacity = tonumber(ARGV[i * 2 - 1])
+	local interval = tonumber(ARGV[i * 2])
+	local bucket = redis.call('HMGET', key, 'tokens', 'updated')
+	local available = tonumber(bucket[1]) or capacity
+	local updated = tonumber(bucket[2]) or now
+	available = math.min(capacity, available + (now - updated) * capacity / interval)
+	if available < 1 then
+		return {i, math.ceil((1 - available) * interval / capacity)}
+	end
+	tokens[i] = available
+end
+
+for i, key in ipairs(KEYS) do
+	redis.call('HMSET', key, 'tokens', tostring(tokens[i] - 1), 'updated', now)
+	redis.call('PEXPIRE', key, tonumber(ARGV[i * 2]))
+end
+return {0, 0}
+`)
+
+type redisLimiter struct {
+	client *redis.Client
+}
+
+// NewRedis is a constructor function for the redisLimiter type. The buckets
+// are kept in redis, so the limits apply across all server instances.
+func NewRedis(redisAddress string) (*redisLimiter, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: redisAddress,
+	})
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis ping %s: %w", redisAddress, err)
+	}
+
+	return &redisLimiter{
+		client: client,
+	}, nil
+}
+
+// Allow takes a token from every bucket, or from none of them when one of
+// the buckets is empty. It returns -1 when the tokens were taken, otherwise
+// the index of the first empty bucket and the time until it has a token.
+func (limiter *redisLimiter) Allow(buckets []model.RateLimitBucket) (int, time.Duration, error) {
+	keys := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, len(buckets)*2)
+	for _, bucket := range buckets {
+		interval := bucket.Limit.Interval.Milliseconds()
+		if interval < 1 {
+			interval = 1
+		}
+		keys = append(keys, keyPrefix+bucket.Key)
+		args = append(args, bucket.Limit.Tokens, interval)
+	}
+
+	result, err := allowScript.Run(limiter.client, keys, args...).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("redis run allow script: %w", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("unexpected allow script result %v", result)
+	}
+	empty, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+
+	// the script counts the buckets from 1
+	return int(empty) - 1, time.Duration(wait) * time.Millisecond, nil
+}
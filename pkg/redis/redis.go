@@ -3,89 +3,466 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
 	"github.com/go-redis/redis"
 )
 
+// roomsKey holds the set of registered room names. Room names cannot contain
+// a colon so the key never clashes with a room's sorted set.
+const roomsKey = "chat:rooms"
+
+// grantsKeyPrefix is followed by the room name, the hash maps a client ID to
+// the client's space separated permissions in the room
+const grantsKeyPrefix = "chat:grants:"
+
+// publishedKeyPrefix is followed by the room name and a deduplication key, it
+// holds the cursor of the message published with the key until the window passes
+const publishedKeyPrefix = "chat:published:"
+
+// roomDeletedPayload is published on the room's channel when the room is
+// deleted, it has no score prefix so it never clashes with a message
+const roomDeletedPayload = "deleted"
+
+// ErrRoomDeleted is sent to the readers of a room when the room is deleted
+var ErrRoomDeleted error = errors.New("room deleted")
+
+const (
+	maxConnectAttempts  = 30
+	maxMessages         = 100
+	healthCheckInterval = time.Second * 30
+)
+
+// publishScript stores a message with a score that is unique within the room
+// and publishes it to the room's channel. Both the sorted set member and the
+// published payload are "<score>:<message>", the score prefix keeps identical
+// messages from collapsing into one member. When a deduplication key is passed
+// and holds a score the message is not stored again.
+// It returns {score, 1 if the message is a duplicate}.
+//
+// KEYS[1] - the room's sorted set, KEYS[2] - the room's pub/sub channel,
+// KEYS[3] - the optional deduplication key
+// ARGV[1] - the requested score, ARGV[2] - the message,
+// ARGV[3] - the deduplication window in milliseconds
+var publishScript = redis.NewScript(`
+if #KEYS == 3 then
+	local published = redis.call('GET', KEYS[3])
+	if published then
+		return {tonumber(published), 1}
+	end
+end
+local score = tonumber(ARGV[1])
+local last = redis.call('ZREVRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if #last > 0 and tonumber(last[2]) >= score then
+	score = tonumber(last[2]) + 1
+end
+local member = string.format('%.0f', score) .. ':' .. ARGV[2]
+redis.call('ZADD', KEYS[1], score, member)
+redis.call('PUBLISH', KEYS[2], member)
+if #KEYS == 3 then
+	redis.call('SET', KEYS[3], string.format('%.0f', score), 'PX', ARGV[3])
+end
+return {score, 0}
+`)
+
 type redisStore struct {
 	client *redis.Client
 }
 
-// New is a constructor function for the redisStore type
-func New(redisAddres string) *redisStore {
+// New is a constructor function for the redisStore type. It waits for redis
+// to become available and gives up after maxConnectAttempts failed pings.
+func New(redisAddres string) (*redisStore, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     redisAddres,
 		Password: "",
 		DB:       0,
 	})
-	for {
-		if err := client.Ping().Err(); err != nil {
-			slog.Error(
-				"error connection to redis",
-				"error", err,
-				"redis_address", redisAddres,
-			)
-			<-time.After(time.Second * 1)
-			continue
+	for attempt := 1; ; attempt++ {
+		err := client.Ping().Err()
+		if err == nil {
+			break
 		}
-		break
+		if attempt == maxConnectAttempts {
+			client.Close()
+			return nil, fmt.Errorf("redis ping %s: %w", redisAddres, err)
+		}
+		slog.Error(
+			"error connection to redis",
+			"error", err,
+			"redis_address", redisAddres,
+			"attempt", attempt,
+		)
+		<-time.After(time.Second * 1)
 	}
 
 	return &redisStore{
 		client: client,
-	}
+	}, nil
 }
 
-// PublishMessage saves a message in the current redis instance
+// PublishMessage saves a message in the current redis instance and notifies
+// all subscribers of the room. The returned value is the score the message was
+// stored with - it is the requested sortKey unless another message already
+// took it, in which case the next free score is used so that scores stay
+// unique and increasing within a room.
 func (store *redisStore) PublishMessage(room string, sortKey float64, message any) (int64, error) {
+	score, _, err := store.publish([]string{room, roomChannel(room)}, sortKey, message, 0)
+	return score, err
+}
+
+// PublishUniqueMessage saves a message unless a message with the same key was
+// published to the room within the window. It returns the score of the stored
+// message and true when the message is a duplicate and was not saved again.
+func (store *redisStore) PublishUniqueMessage(room, key string, window time.Duration, sortKey float64, message any) (int64, bool, error) {
+	keys := []string{room, roomChannel(room), publishedKeyPrefix + room + ":" + key}
+	return store.publish(keys, sortKey, message, window)
+}
+
+func (store *redisStore) publish(keys []string, sortKey float64, message any, window time.Duration) (int64, bool, error) {
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
-		return 0, fmt.Errorf("json marshal: %w", err)
+		return 0, false, fmt.Errorf("json marshal: %w", err)
 	}
 
-	setMember := redis.Z{Score: sortKey, Member: string(messageBytes)}
-
-	result, err := store.client.ZAdd(room, setMember).Result()
+	result, err := publishScript.Run(
+		store.client,
+		keys,
+		int64(sortKey),
+		string(messageBytes),
+		window.Milliseconds(),
+	).Result()
 	if err != nil {
-		return 0, fmt.Errorf("redis ZAdd: %w", err)
+		return 0, false, fmt.Errorf("redis publish script: %w", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, false, fmt.Errorf("unexpected publish script result %v", result)
 	}
+	score, _ := values[0].(int64)
+	duplicate, _ := values[1].(int64)
 
-	return result, nil
+	return score, duplicate == 1, nil
 }
 
-// ReadMessages reads messages from the current redis instance
-func (store *redisStore) ReadMessages(ctx context.Context, room string) (<-chan string, <-chan error) {
-	msgsChan := make(chan string)
+// ReadMessages reads messages from the current redis instance. All messages
+// stored in the room after the since cursor are sent first, after that new
+// messages are pushed to the channel as soon as they are published. Both
+// channels are closed once the context is cancelled. When the room is deleted
+// ErrRoomDeleted is sent and both channels are closed.
+func (store *redisStore) ReadMessages(ctx context.Context, room string, since int64) (<-chan model.StoredMessage, <-chan error) {
+	msgsChan := make(chan model.StoredMessage)
 	errorsChan := make(chan error)
-	var offset int64
-	var maxMessages int64 = 100
 
 	go func() {
-		for {
-			<-time.After(time.Millisecond * 200)
+		defer close(msgsChan)
+		defer close(errorsChan)
+
+		sendError := func(err error) bool {
 			select {
+			case errorsChan <- err:
+				return true
 			case <-ctx.Done():
-				close(msgsChan)
-				close(errorsChan)
-				return
-			default:
-				messages, err := store.client.ZRange(room, offset, offset+maxMessages).Result()
+				return false
+			}
+		}
+
+		// subscribe before reading the backlog so no message published in between is missed
+		pubsub := store.client.Subscribe(roomChannel(room))
+		defer pubsub.Close()
+
+		// unblock a pending receive when the context is cancelled
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				pubsub.Close()
+			case <-stop:
+			}
+		}()
+
+		if _, err := pubsub.Receive(); err != nil {
+			sendError(fmt.Errorf("redis subscribe: %w", err))
+			return
+		}
+
+		lastScore := float64(since)
+		catchUp := func() bool {
+			for {
+				messages, err := store.client.ZRangeByScoreWithScores(room, redis.ZRangeBy{
+					Min:   scoreAfter(lastScore),
+					Max:   "+inf",
+					Count: maxMessages,
+				}).Result()
 				if err != nil {
-					errorsChan <- fmt.Errorf("redis ZRange: %w", err)
-					continue
+					return sendError(fmt.Errorf("redis ZRangeByScore: %w", err))
 				}
-				if len(messages) == 0 {
+				for _, msg := range messages {
+					select {
+					case msgsChan <- storedMessage(msg):
+						lastScore = msg.Score
+					case <-ctx.Done():
+						return false
+					}
+				}
+				if len(messages) < maxMessages {
+					return true
+				}
+			}
+		}
+
+		if !catchUp() {
+			return
+		}
+
+		for {
+			received, err := pubsub.ReceiveTimeout(healthCheckInterval)
+			if ctx.Err() != nil {
+				return
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// no traffic on the connection, make sure it is still alive
+				if err := pubsub.Ping(); err != nil && !sendError(fmt.Errorf("redis ping: %w", err)) {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				if !sendError(fmt.Errorf("redis receive: %w", err)) {
+					return
+				}
+				// the connection was lost - resubscribe and read whatever was published meanwhile
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+				if err := pubsub.Ping(); err != nil {
 					continue
 				}
-				for _, msg := range messages {
-					msgsChan <- msg
+				if !catchUp() {
+					return
 				}
-				offset += int64(len(messages))
+				continue
+			}
+
+			msg, ok := received.(*redis.Message)
+			if !ok {
+				continue
+			}
+			if msg.Payload == roomDeletedPayload {
+				sendError(fmt.Errorf("room %q: %w", room, ErrRoomDeleted))
+				return
+			}
+			rawScore, _, found := strings.Cut(msg.Payload, ":")
+			if !found {
+				continue
+			}
+			score, err := strconv.ParseFloat(rawScore, 64)
+			if err != nil {
+				if !sendError(fmt.Errorf("parse message score: %w", err)) {
+					return
+				}
+				continue
+			}
+			if score <= lastScore {
+				// already sent while catching up
+				continue
+			}
+
+			select {
+			case msgsChan <- storedMessage(redis.Z{Score: score, Member: msg.Payload}):
+				lastScore = score
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 	return msgsChan, errorsChan
 }
+
+// ReadRange reads up to limit messages with cursors between after and before
+// (both exclusive, 0 means unbounded) in ascending cursor order. When newest is
+// set the messages closest to before are returned, otherwise the ones closest
+// to after. A limit of 0 or less returns no messages.
+func (store *redisStore) ReadRange(room string, after, before int64, limit int64, newest bool) ([]model.StoredMessage, error) {
+	if limit <= 0 {
+		return []model.StoredMessage{}, nil
+	}
+
+	opt := redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "+inf",
+		Count: limit,
+	}
+	if after > 0 {
+		opt.Min = scoreAfter(float64(after))
+	}
+	if before > 0 {
+		opt.Max = "(" + strconv.FormatInt(before, 10)
+	}
+
+	var members []redis.Z
+	var err error
+	if newest {
+		members, err = store.client.ZRevRangeByScoreWithScores(room, opt).Result()
+	} else {
+		members, err = store.client.ZRangeByScoreWithScores(room, opt).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis range by score: %w", err)
+	}
+
+	messages := make([]model.StoredMessage, len(members))
+	for i, member := range members {
+		idx := i
+		if newest {
+			idx = len(members) - 1 - i
+		}
+		messages[idx] = storedMessage(member)
+	}
+
+	return messages, nil
+}
+
+// storedMessage strips the score prefix from a sorted set member, members
+// stored before the prefix was added are the bare message
+func storedMessage(member redis.Z) model.StoredMessage {
+	message := member.Member.(string)
+	cursor := int64(member.Score)
+	if rest, found := strings.CutPrefix(message, strconv.FormatInt(cursor, 10)+":"); found {
+		message = rest
+	}
+	return model.StoredMessage{Cursor: cursor, Message: message}
+}
+
+// roomChannel returns the pub/sub channel the room's new messages are published on
+func roomChannel(room string) string {
+	return "chat:room:" + room
+}
+
+// scoreAfter returns an exclusive ZRANGEBYSCORE lower bound for the given score
+func scoreAfter(score float64) string {
+	return "(" + strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// CreateRoom registers the room in the rooms set; it returns false if the room already exists
+func (store *redisStore) CreateRoom(room string) (bool, error) {
+	added, err := store.client.SAdd(roomsKey, room).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis SAdd: %w", err)
+	}
+	return added == 1, nil
+}
+
+// DeleteRoom removes the room from the rooms set together with its messages,
+// grants and deduplication keys and tells the room's readers; it returns false
+// if the room does not exist
+func (store *redisStore) DeleteRoom(room string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := store.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		removed = pipe.SRem(roomsKey, room)
+		pipe.Del(room, grantsKey(room))
+		pipe.Publish(roomChannel(room), roomDeletedPayload)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("redis delete room: %w", err)
+	}
+
+	// a room created again with the same name must not see the old keys
+	iter := store.client.Scan(0, publishedKeyPrefix+escapeGlob(room)+":*", maxMessages).Iterator()
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return false, fmt.Errorf("redis scan published keys: %w", err)
+	}
+	if len(keys) > 0 {
+		if err := store.client.Del(keys...).Err(); err != nil {
+			return false, fmt.Errorf("redis delete published keys: %w", err)
+		}
+	}
+
+	return removed.Val() == 1, nil
+}
+
+// escapeGlob escapes the characters of a key that are special in a SCAN pattern
+func escapeGlob(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ListRooms returns the names of all registered rooms in alphabetical order
+func (store *redisStore) ListRooms() ([]string, error) {
+	rooms, err := store.client.SMembers(roomsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis SMembers: %w", err)
+	}
+	sort.Strings(rooms)
+	return rooms, nil
+}
+
+// RoomExists checks whether the room is registered
+func (store *redisStore) RoomExists(room string) (bool, error) {
+	exists, err := store.client.SIsMember(roomsKey, room).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis SIsMember: %w", err)
+	}
+	return exists, nil
+}
+
+// Grants returns the grants of the room
+func (store *redisStore) Grants(room string) ([]model.Grant, error) {
+	fields, err := store.client.HGetAll(grantsKey(room)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis HGetAll: %w", err)
+	}
+
+	grants := make([]model.Grant, 0, len(fields))
+	for clientID, permissions := range fields {
+		grants = append(grants, model.Grant{
+			ClientID:    clientID,
+			Permissions: strings.Fields(permissions),
+		})
+	}
+	return grants, nil
+}
+
+// SetGrant replaces the permissions of the grant's client in the room
+func (store *redisStore) SetGrant(room string, grant model.Grant) error {
+	err := store.client.HSet(grantsKey(room), grant.ClientID, strings.Join(grant.Permissions, " ")).Err()
+	if err != nil {
+		return fmt.Errorf("redis HSet: %w", err)
+	}
+	return nil
+}
+
+// DeleteGrant removes the client's grant in the room; it returns false if there is none
+func (store *redisStore) DeleteGrant(room, clientID string) (bool, error) {
+	deleted, err := store.client.HDel(grantsKey(room), clientID).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis HDel: %w", err)
+	}
+	return deleted == 1, nil
+}
+
+func grantsKey(room string) string {
+	return grantsKeyPrefix + room
+}
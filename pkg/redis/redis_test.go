@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+func newTestStore(t *testing.T) (*redisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	store, err := New(server.Addr())
+	if err != nil {
+		t.Fatalf("new redis store: %v", err)
+	}
+	t.Cleanup(func() { store.client.Close() })
+	return store, server
+}
+
+func TestPublishIdenticalMessages(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages, _ := store.ReadMessages(ctx, "room", 0)
+
+	// the same message pushed twice in the same millisecond
+	for _, want := range []int64{1, 2} {
+		cursor, err := store.PublishMessage("room", 1, "hello")
+		if err != nil {
+			t.Fatalf("publish message: %v", err)
+		}
+		if cursor != want {
+			t.Fatalf("got cursor %d, want %d", cursor, want)
+		}
+	}
+
+	want := []model.StoredMessage{{Cursor: 1, Message: `"hello"`}, {Cursor: 2, Message: `"hello"`}}
+	page, err := store.ReadRange("room", 0, 0, 10, false)
+	if err != nil {
+		t.Fatalf("read range: %v", err)
+	}
+	if len(page) != len(want) {
+		t.Fatalf("got %d stored messages, want %d", len(page), len(want))
+	}
+	for i := range want {
+		if page[i] != want[i] {
+			t.Fatalf("got stored message %+v, want %+v", page[i], want[i])
+		}
+	}
+
+	for i := range want {
+		select {
+		case msg := <-messages:
+			if msg != want[i] {
+				t.Fatalf("got read message %+v, want %+v", msg, want[i])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("message %d not read", i+1)
+		}
+	}
+}
+
+func TestPublishUniqueMessage(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	cursor, duplicate, err := store.PublishUniqueMessage("room", "Jim:1", time.Minute, 1, "hello")
+	if err != nil || duplicate || cursor != 1 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want cursor 1", cursor, duplicate, err)
+	}
+	// an identical message with another key is stored as well
+	cursor, duplicate, err = store.PublishUniqueMessage("room", "Jim:2", time.Minute, 1, "hello")
+	if err != nil || duplicate || cursor != 2 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want cursor 2", cursor, duplicate, err)
+	}
+	cursor, duplicate, err = store.PublishUniqueMessage("room", "Jim:1", time.Minute, 5, "hello")
+	if err != nil || !duplicate || cursor != 1 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want duplicate of cursor 1", cursor, duplicate, err)
+	}
+
+	page, err := store.ReadRange("room", 0, 0, 10, false)
+	if err != nil {
+		t.Fatalf("read range: %v", err)
+	}
+	if len(page) != 2 {
+		t.Fatalf("got %d stored messages, want 2", len(page))
+	}
+}
+
+func TestStoredMessageWithoutScorePrefix(t *testing.T) {
+	// members stored before the score prefix was added are the bare message
+	store, server := newTestStore(t)
+	server.ZAdd("room", 7, `{"message":"12:30"}`)
+
+	page, err := store.ReadRange("room", 0, 0, 10, false)
+	if err != nil {
+		t.Fatalf("read range: %v", err)
+	}
+	want := model.StoredMessage{Cursor: 7, Message: `{"message":"12:30"}`}
+	if len(page) != 1 || page[0] != want {
+		t.Fatalf("got %+v, want %+v", page, want)
+	}
+}
+
+func TestReadRangeZeroLimit(t *testing.T) {
+	store, _ := newTestStore(t)
+	for _, sortKey := range []float64{1, 2, 3} {
+		if _, err := store.PublishMessage("room", sortKey, "hello"); err != nil {
+			t.Fatalf("publish message: %v", err)
+		}
+	}
+
+	page, err := store.ReadRange("room", 0, 0, 0, false)
+	if err != nil {
+		t.Fatalf("read range: %v", err)
+	}
+	if len(page) != 0 {
+		t.Fatalf("got %d messages, want none", len(page))
+	}
+}
+
+func TestDeleteRoomEndsReaders(t *testing.T) {
+	store, server := newTestStore(t)
+	if _, err := store.CreateRoom("room"); err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	if _, _, err := store.PublishUniqueMessage("room", "Jim:1", time.Minute, 1, "hello"); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+
+	messages, errs := store.ReadMessages(context.Background(), "room", 0)
+	select {
+	case msg := <-messages:
+		if msg.Cursor != 1 {
+			t.Fatalf("got cursor %d, want 1", msg.Cursor)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stored message not read")
+	}
+
+	if deleted, err := store.DeleteRoom("room"); err != nil || !deleted {
+		t.Fatalf("delete room: deleted %t, error %v", deleted, err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrRoomDeleted) {
+			t.Fatalf("got error %v, want %v", err, ErrRoomDeleted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reader not ended after the room was deleted")
+	}
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatal("message read after the room was deleted")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("messages channel not closed after the room was deleted")
+	}
+
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Fatalf("got keys %v left after the room was deleted", keys)
+	}
+}
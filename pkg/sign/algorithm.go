@@ -0,0 +1,101 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+)
+
+// Algorithm is a signing algorithm supported by the package
+type Algorithm string
+
+const (
+	// AlgorithmECDSA signs the SHA-256 hash of the message with an EC key
+	AlgorithmECDSA Algorithm = "ecdsa"
+	// AlgorithmEd25519 signs the message with an Ed25519 key
+	AlgorithmEd25519 Algorithm = "ed25519"
+	// AlgorithmRSAPSS signs the SHA-256 hash of the message with an RSA key and PSS padding
+	AlgorithmRSAPSS Algorithm = "rsa-pss"
+	// AlgorithmHMAC authenticates the message with HMAC-SHA256 and a shared secret
+	AlgorithmHMAC Algorithm = "hmac-sha256"
+)
+
+// ParseAlgorithm converts a config value to an Algorithm
+func ParseAlgorithm(algorithm string) (Algorithm, error) {
+	switch a := Algorithm(algorithm); a {
+	case AlgorithmECDSA, AlgorithmEd25519, AlgorithmRSAPSS, AlgorithmHMAC:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown signing algorithm %q", algorithm)
+	}
+}
+
+// KeyAlgorithm returns the algorithm a private key signs with. HMAC secrets
+// are passed as a []byte.
+func KeyAlgorithm(privateKey crypto.PrivateKey) (Algorithm, error) {
+	switch privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return AlgorithmECDSA, nil
+	case ed25519.PrivateKey:
+		return AlgorithmEd25519, nil
+	case *rsa.PrivateKey:
+		return AlgorithmRSAPSS, nil
+	case []byte:
+		return AlgorithmHMAC, nil
+	default:
+		return "", fmt.Errorf("%T: %w", privateKey, ErrUnsupportedKey)
+	}
+}
+
+// NewSigner creates the signer for the type of the private key. The hasher is
+// used by ECDSA only, the other algorithms use SHA-256 or no separate hash.
+func NewSigner(privateKey crypto.PrivateKey, hasher Hasher, encoder Encoder) (Signer, error) {
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return NewECDSA(key, hasher, encoder), nil
+	case ed25519.PrivateKey:
+		return NewEd25519(key, encoder), nil
+	case *rsa.PrivateKey:
+		return NewRSAPSS(key, encoder)
+	case []byte:
+		return NewHMAC(key, encoder)
+	default:
+		return nil, fmt.Errorf("%T: %w", privateKey, ErrUnsupportedKey)
+	}
+}
+
+// NewVerifier creates the verifier for the type of the public key. HMAC
+// secrets are passed as a []byte.
+func NewVerifier(publicKey crypto.PublicKey, hasher Hasher, encoder Encoder) (Verifier, error) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return NewECDSAVerifier(key, hasher, encoder), nil
+	case ed25519.PublicKey:
+		return NewEd25519Verifier(key, encoder), nil
+	case *rsa.PublicKey:
+		return NewRSAPSSVerifier(key, encoder), nil
+	case []byte:
+		return NewHMAC(key, encoder)
+	default:
+		return nil, fmt.Errorf("%T: %w", publicKey, ErrUnsupportedKey)
+	}
+}
+
+// PublicKey returns the key that verifies the signatures of the private key,
+// for HMAC secrets it is the secret itself
+func PublicKey(privateKey crypto.PrivateKey) (crypto.PublicKey, error) {
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey, nil
+	case ed25519.PrivateKey:
+		return key.Public(), nil
+	case *rsa.PrivateKey:
+		return &key.PublicKey, nil
+	case []byte:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%T: %w", privateKey, ErrUnsupportedKey)
+	}
+}
@@ -0,0 +1,49 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+type ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+	encoder    Encoder
+}
+
+// NewEd25519 is a constructor function for the ed25519Signer type
+func NewEd25519(privKey ed25519.PrivateKey, encoder Encoder) *ed25519Signer {
+	return &ed25519Signer{
+		privateKey: privKey,
+		encoder:    encoder,
+	}
+}
+
+// Sign generates a digital signature based on the provided message
+func (ed *ed25519Signer) Sign(message string) (string, error) {
+	signatureBytes := ed25519.Sign(ed.privateKey, []byte(message))
+	return ed.encoder.Encode(signatureBytes), nil
+}
+
+type ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+	encoder   Encoder
+}
+
+// NewEd25519Verifier is a constructor function for the ed25519Verifier type
+func NewEd25519Verifier(pubKey ed25519.PublicKey, encoder Encoder) *ed25519Verifier {
+	return &ed25519Verifier{
+		publicKey: pubKey,
+		encoder:   encoder,
+	}
+}
+
+// Verify checks the validity of the given signature
+func (ed *ed25519Verifier) Verify(signature, message string) (bool, error) {
+	signatureBytes, err := ed.encoder.Decode(signature)
+	if err != nil {
+		return false, fmt.Errorf("signature string decode: %w", err)
+	}
+
+	valid := ed25519.Verify(ed.publicKey, []byte(message), signatureBytes)
+	return valid, nil
+}
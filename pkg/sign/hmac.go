@@ -0,0 +1,47 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// minHMACKeySize is the smallest HMAC secret in bytes, the size of the SHA-256 output
+const minHMACKeySize = 32
+
+type hmacSigner struct {
+	secret  []byte
+	encoder Encoder
+}
+
+// NewHMAC is a constructor function for the hmacSigner type. It signs and
+// verifies with HMAC-SHA256, so every verifier needs the secret.
+func NewHMAC(secret []byte, encoder Encoder) (*hmacSigner, error) {
+	if len(secret) < minHMACKeySize {
+		return nil, fmt.Errorf("hmac secret of %d bytes, at least %d required: %w", len(secret), minHMACKeySize, ErrUnsupportedKey)
+	}
+	return &hmacSigner{
+		secret:  secret,
+		encoder: encoder,
+	}, nil
+}
+
+// Sign generates a message authentication code based on the provided message
+func (h *hmacSigner) Sign(message string) (string, error) {
+	return h.encoder.Encode(h.mac(message)), nil
+}
+
+// Verify checks the validity of the given message authentication code
+func (h *hmacSigner) Verify(signature, message string) (bool, error) {
+	signatureBytes, err := h.encoder.Decode(signature)
+	if err != nil {
+		return false, fmt.Errorf("signature string decode: %w", err)
+	}
+	return hmac.Equal(signatureBytes, h.mac(message)), nil
+}
+
+func (h *hmacSigner) mac(message string) []byte {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
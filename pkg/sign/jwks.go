@@ -0,0 +1,208 @@
+package sign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+var ErrUnsupportedKey error = errors.New("key type not supported")
+var ErrEmptyKeySet error = errors.New("key set has no keys")
+
+// JSONWebKey is a public key in the JSON Web Key format (RFC 7517)
+type JSONWebKey struct {
+	KeyType string `json:"kty"`
+	Use     string `json:"use,omitempty"`
+	KeyID   string `json:"kid,omitempty"`
+	Curve   string `json:"crv,omitempty"`
+	X       string `json:"x,omitempty"`
+	Y       string `json:"y,omitempty"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+}
+
+// JSONWebKeySet is a set of public keys in the JSON Web Key Set format
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey converts an ECDSA, Ed25519 or RSA public key to a JSON Web Key.
+// The key ID is the key's RFC 7638 thumbprint.
+func NewJSONWebKey(publicKey crypto.PublicKey) (JSONWebKey, error) {
+	var key JSONWebKey
+	// the thumbprint input has the required members in lexicographic order
+	var thumbprintInput string
+
+	switch pub := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		params := pub.Curve.Params()
+		switch params.Name {
+		case "P-256", "P-384", "P-521":
+		default:
+			return JSONWebKey{}, fmt.Errorf("curve %s: %w", params.Name, ErrUnsupportedKey)
+		}
+		size := (params.BitSize + 7) / 8
+		key = JSONWebKey{
+			KeyType: "EC",
+			Curve:   params.Name,
+			X:       base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:       base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+		thumbprintInput = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, key.Curve, key.X, key.Y)
+	case ed25519.PublicKey:
+		key = JSONWebKey{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(pub),
+		}
+		thumbprintInput = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":%q}`, key.X)
+	case *rsa.PublicKey:
+		key = JSONWebKey{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+		thumbprintInput = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, key.E, key.N)
+	default:
+		return JSONWebKey{}, fmt.Errorf("%T: %w", publicKey, ErrUnsupportedKey)
+	}
+
+	key.Use = "sig"
+	key.KeyID = thumbprint(thumbprintInput)
+	return key, nil
+}
+
+// PublicKey converts the JSON Web Key back to an ECDSA, Ed25519 or RSA public key
+func (key JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch key.KeyType {
+	case "EC":
+		return key.ecdsaPublicKey()
+	case "OKP":
+		if key.Curve != "Ed25519" {
+			return nil, fmt.Errorf("curve %q: %w", key.Curve, ErrUnsupportedKey)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decode x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("ed25519 public key of invalid size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decode n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decode e: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa public exponent not valid")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	default:
+		return nil, fmt.Errorf("key type %q: %w", key.KeyType, ErrUnsupportedKey)
+	}
+}
+
+func (key JSONWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch key.Curve {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("curve %q: %w", key.Curve, ErrUnsupportedKey)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode x: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode y: %w", err)
+	}
+
+	publicKey := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+
+	return publicKey, nil
+}
+
+// KeyID returns the RFC 7638 thumbprint of a public key or of an HMAC secret
+func KeyID(publicKey crypto.PublicKey) (string, error) {
+	if secret, ok := publicKey.([]byte); ok {
+		k := base64.RawURLEncoding.EncodeToString(secret)
+		return thumbprint(fmt.Sprintf(`{"k":%q,"kty":"oct"}`, k)), nil
+	}
+	key, err := NewJSONWebKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return key.KeyID, nil
+}
+
+func thumbprint(input string) string {
+	hash := sha256.Sum256([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// ParseJSONWebKeySet decodes a JSON Web Key Set document
+func ParseJSONWebKeySet(data []byte) (JSONWebKeySet, error) {
+	keySet := JSONWebKeySet{}
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return JSONWebKeySet{}, fmt.Errorf("json unmarshal key set: %w", err)
+	}
+	return keySet, nil
+}
+
+// FetchJSONWebKeySet downloads the JSON Web Key Set published at url, e.g. the
+// chat server's /.well-known/jwks.json endpoint
+func FetchJSONWebKeySet(ctx context.Context, client *http.Client, url string) (JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return JSONWebKeySet{}, fmt.Errorf("new request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return JSONWebKeySet{}, fmt.Errorf("get key set: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return JSONWebKeySet{}, fmt.Errorf("get key set: unexpected status %s", resp.Status)
+	}
+
+	keySet := JSONWebKeySet{}
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return JSONWebKeySet{}, fmt.Errorf("json decode key set: %w", err)
+	}
+	return keySet, nil
+}
@@ -0,0 +1,308 @@
+package sign
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidKeyID error = errors.New("key ID not valid")
+
+// keyIDPattern keeps key IDs free of the separators used in signatures and tokens
+var keyIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+// Key is a signing key of a keyring
+type Key struct {
+	// ID is put in every signature made with the key
+	ID string
+	// PrivateKey is an ECDSA, Ed25519 or RSA private key or an HMAC secret as a []byte
+	PrivateKey crypto.PrivateKey
+	// Since is when the key was added, the newest key signs unless a key is Active
+	Since time.Time
+	// Active marks the key that signs, it overrides the order of the keys
+	Active bool
+}
+
+// KeySource loads the keys of a keyring
+type KeySource interface {
+	Keys() ([]Key, error)
+}
+
+// keyringEntry is a key of the keyring that still verifies signatures
+type keyringEntry struct {
+	verifier Verifier
+	// publicKey is published in the key set, nil for HMAC secrets
+	publicKey *JSONWebKey
+	// retiredAt is when the keyring first saw this key replaced or removed,
+	// zero for the active key
+	retiredAt time.Time
+}
+
+type keyring struct {
+	source    KeySource
+	algorithm Algorithm
+	grace     time.Duration
+	hasher    Hasher
+	encoder   Encoder
+	now       func() time.Time
+
+	// reloadMu serializes the reloads, each one builds on the keys of the previous
+	reloadMu sync.Mutex
+
+	mu       sync.RWMutex
+	activeID string
+	active   Signer
+	entries  map[string]keyringEntry
+}
+
+// NewKeyring is a constructor function for the keyring type. The keys are
+// loaded from the source, the key marked active or else the one added last
+// signs and must be a key of the given algorithm. Every other key, of any
+// algorithm, still verifies signatures for the grace period after the keyring
+// saw it replaced or removed. Signatures have the form "<key ID>:<signature>".
+func NewKeyring(source KeySource, algorithm Algorithm, grace time.Duration, hasher Hasher, encoder Encoder) (*keyring, error) {
+	ring := &keyring{
+		source:    source,
+		algorithm: algorithm,
+		grace:     grace,
+		hasher:    hasher,
+		encoder:   encoder,
+		now:       time.Now,
+	}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Reload loads the keys from the source again. The grace period of a key
+// starts when Reload first sees it replaced or removed, so it does not depend
+// on file times, and removed keys are kept until it has passed. Keys that are
+// already replaced when the keyring is created get the full grace period. The
+// keyring keeps its current keys if loading fails.
+func (ring *keyring) Reload() error {
+	ring.reloadMu.Lock()
+	defer ring.reloadMu.Unlock()
+
+	keys, err := ring.source.Keys()
+	if err != nil {
+		return fmt.Errorf("load keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return ErrEmptyKeySet
+	}
+
+	active, err := activeKey(keys)
+	if err != nil {
+		return err
+	}
+	algorithm, err := KeyAlgorithm(active.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", active.ID, err)
+	}
+	if algorithm != ring.algorithm {
+		return fmt.Errorf("signing key %q is a %s key, expected %s: %w", active.ID, algorithm, ring.algorithm, ErrUnsupportedKey)
+	}
+	signer, err := NewSigner(active.PrivateKey, ring.hasher, ring.encoder)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", active.ID, err)
+	}
+
+	now := ring.now()
+	ring.mu.RLock()
+	previous := ring.entries
+	ring.mu.RUnlock()
+
+	entries := make(map[string]keyringEntry, len(keys))
+	for _, key := range keys {
+		if !keyIDPattern.MatchString(key.ID) {
+			return fmt.Errorf("key %q: %w", key.ID, ErrInvalidKeyID)
+		}
+		if _, ok := entries[key.ID]; ok {
+			return fmt.Errorf("duplicate key %q: %w", key.ID, ErrInvalidKeyID)
+		}
+		publicKey, err := PublicKey(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		verifier, err := NewVerifier(publicKey, ring.hasher, ring.encoder)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.ID, err)
+		}
+
+		entry := keyringEntry{
+			verifier: verifier,
+		}
+		if _, ok := publicKey.([]byte); !ok {
+			jwk, err := NewJSONWebKey(publicKey)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key.ID, err)
+			}
+			jwk.KeyID = key.ID
+			entry.publicKey = &jwk
+		}
+		if key.ID != active.ID {
+			entry.retiredAt = retiredAt(previous[key.ID], now)
+		}
+		entries[key.ID] = entry
+	}
+
+	// removed keys keep verifying until their grace period has passed
+	for id, entry := range previous {
+		if _, ok := entries[id]; ok {
+			continue
+		}
+		entry.retiredAt = retiredAt(entry, now)
+		if ring.valid(entry, now) {
+			entries[id] = entry
+		}
+	}
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	ring.activeID = active.ID
+	ring.active = signer
+	ring.entries = entries
+	return nil
+}
+
+// activeKey returns the key marked active or else the key added last, keys
+// added at the same time are ordered by ID
+func activeKey(keys []Key) (Key, error) {
+	var active []Key
+	for _, key := range keys {
+		if key.Active {
+			active = append(active, key)
+		}
+	}
+	switch len(active) {
+	case 0:
+	case 1:
+		return active[0], nil
+	default:
+		return Key{}, fmt.Errorf("keys %q and %q both marked active: %w", active[0].ID, active[1].ID, ErrInvalidKeyID)
+	}
+
+	latest := keys[0]
+	for _, key := range keys[1:] {
+		if key.Since.After(latest.Since) || (key.Since.Equal(latest.Since) && key.ID > latest.ID) {
+			latest = key
+		}
+	}
+	return latest, nil
+}
+
+// retiredAt returns when a key that is no longer active was retired, the
+// retirement time already recorded for it or else now
+func retiredAt(previous keyringEntry, now time.Time) time.Time {
+	if previous.retiredAt.IsZero() {
+		return now
+	}
+	return previous.retiredAt
+}
+
+// Watch reloads the keys every interval until the context is done. Errors are
+// passed to onError and the current keys are kept.
+func (ring *keyring) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ring.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Sign generates a digital signature with the active key, prefixed with its key ID
+func (ring *keyring) Sign(message string) (string, error) {
+	ring.mu.RLock()
+	activeID, active := ring.activeID, ring.active
+	ring.mu.RUnlock()
+
+	signature, err := active.Sign(message)
+	if err != nil {
+		return "", err
+	}
+	return activeID + ":" + signature, nil
+}
+
+// Verify checks the validity of the given signature with the key it names.
+// Signatures without a key ID are checked against every valid key.
+func (ring *keyring) Verify(signature, message string) (bool, error) {
+	keyID, signature := splitKeyID(signature)
+	now := ring.now()
+
+	ring.mu.RLock()
+	entries := ring.entries
+	ring.mu.RUnlock()
+
+	if keyID != "" {
+		entry, ok := entries[keyID]
+		if !ok || !ring.valid(entry, now) {
+			return false, nil
+		}
+		return entry.verifier.Verify(signature, message)
+	}
+
+	for _, entry := range entries {
+		if !ring.valid(entry, now) {
+			continue
+		}
+		valid, err := entry.verifier.Verify(signature, message)
+		if err != nil {
+			return false, err
+		}
+		if valid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// KeySet returns the public keys that currently verify signatures, HMAC
+// secrets are never published
+func (ring *keyring) KeySet() (JSONWebKeySet, error) {
+	now := ring.now()
+
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, entry := range ring.entries {
+		if entry.publicKey != nil && ring.valid(entry, now) {
+			keySet.Keys = append(keySet.Keys, *entry.publicKey)
+		}
+	}
+	sort.Slice(keySet.Keys, func(i, j int) bool {
+		return keySet.Keys[i].KeyID < keySet.Keys[j].KeyID
+	})
+	return keySet, nil
+}
+
+// valid reports whether the key is active or still within its grace period
+func (ring *keyring) valid(entry keyringEntry, now time.Time) bool {
+	return entry.retiredAt.IsZero() || now.Before(entry.retiredAt.Add(ring.grace))
+}
+
+// splitKeyID separates a "<key ID>:<signature>" signature, the key ID is
+// empty for signatures made without a keyring
+func splitKeyID(signature string) (string, string) {
+	keyID, rest, found := strings.Cut(signature, ":")
+	if !found {
+		return "", signature
+	}
+	return keyID, rest
+}
@@ -0,0 +1,207 @@
+package sign
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testSource serves whatever keys it is set to
+type testSource struct {
+	keys []Key
+}
+
+func (source *testSource) Keys() ([]Key, error) {
+	return source.keys, nil
+}
+
+func secretKey(id string, since time.Time) Key {
+	return Key{ID: id, PrivateKey: bytes.Repeat([]byte(id[:1]), 32), Since: since}
+}
+
+func newTestKeyring(t *testing.T, source KeySource, now *time.Time) *keyring {
+	t.Helper()
+
+	ring := &keyring{
+		source:    source,
+		algorithm: AlgorithmHMAC,
+		grace:     time.Hour,
+		hasher:    NewSHA256Hasher(),
+		encoder:   NewBase64Encoder(),
+		now:       func() time.Time { return *now },
+	}
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("load keyring: %v", err)
+	}
+	return ring
+}
+
+func verifies(t *testing.T, ring *keyring, signature string) bool {
+	t.Helper()
+
+	valid, err := ring.Verify(signature, "message")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return valid
+}
+
+func TestKeyringGraceStartsWhenReplacementSeen(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	// the replacing key was copied with a file time far in the past
+	source := &testSource{keys: []Key{secretKey("a", now.Add(-time.Hour))}}
+	ring := newTestKeyring(t, source, &now)
+
+	signature, err := ring.Sign("message")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	source.keys = append(source.keys, secretKey("b", now.Add(-48*time.Hour)), secretKey("c", now.Add(-72*time.Hour)))
+	source.keys[1].Active = true
+	now = now.Add(10 * time.Minute)
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if ring.activeID != "b" {
+		t.Fatalf("got active key %q, want the marked key b", ring.activeID)
+	}
+	if !verifies(t, ring, signature) {
+		t.Fatal("replaced key rejected within the grace period")
+	}
+
+	// a later reload does not restart the grace period
+	now = now.Add(50 * time.Minute)
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !verifies(t, ring, signature) {
+		t.Fatal("replaced key rejected within the grace period")
+	}
+	now = now.Add(10 * time.Minute)
+	if verifies(t, ring, signature) {
+		t.Fatal("replaced key accepted after the grace period")
+	}
+}
+
+func TestKeyringKeepsRemovedKeysForGrace(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	source := &testSource{keys: []Key{secretKey("a", now)}}
+	ring := newTestKeyring(t, source, &now)
+
+	signature, err := ring.Sign("message")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	source.keys = []Key{secretKey("b", now)}
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	now = now.Add(30 * time.Minute)
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !verifies(t, ring, signature) {
+		t.Fatal("removed key rejected within the grace period")
+	}
+
+	now = now.Add(30 * time.Minute)
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if verifies(t, ring, signature) {
+		t.Fatal("removed key accepted after the grace period")
+	}
+	if _, ok := ring.entries["a"]; ok {
+		t.Fatal("removed key kept after the grace period")
+	}
+}
+
+func TestActiveKey(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		keys    []Key
+		want    string
+		wantErr error
+	}{
+		{
+			name: "newest key",
+			keys: []Key{secretKey("key-10", now), secretKey("key-9", now.Add(-time.Hour))},
+			want: "key-10",
+		},
+		{
+			name: "same time ordered by ID",
+			keys: []Key{secretKey("b", now), secretKey("a", now)},
+			want: "b",
+		},
+		{
+			name: "marked key",
+			keys: []Key{secretKey("a", now), {ID: "b", Since: now.Add(-time.Hour), Active: true}},
+			want: "b",
+		},
+		{
+			name:    "two marked keys",
+			keys:    []Key{{ID: "a", Active: true}, {ID: "b", Active: true}},
+			wantErr: ErrInvalidKeyID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := activeKey(tt.keys)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got.ID != tt.want {
+				t.Fatalf("got active key %q, want %q", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirSourceActiveFile(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, modTime := range map[string]time.Time{"key-9.key": now, "key-10.key": now.Add(-time.Hour)} {
+		path := filepath.Join(dir, name)
+		secret := []byte("c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA==")
+		if err := os.WriteFile(path, secret, 0o600); err != nil {
+			t.Fatalf("write key file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("set key file time: %v", err)
+		}
+	}
+	source := NewDirSource(dir)
+
+	keys, err := source.Keys()
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	if active, _ := activeKey(keys); active.ID != "key-9" {
+		t.Fatalf("got active key %q, want the newest file key-9", active.ID)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, activeFileName), []byte("key-10\n"), 0o600); err != nil {
+		t.Fatalf("write active file: %v", err)
+	}
+	keys, err = source.Keys()
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	if active, _ := activeKey(keys); active.ID != "key-10" {
+		t.Fatalf("got active key %q, want key-10 named in the active file", active.ID)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, activeFileName), []byte("key-11"), 0o600); err != nil {
+		t.Fatalf("write active file: %v", err)
+	}
+	if _, err := source.Keys(); !errors.Is(err, ErrInvalidKeyID) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidKeyID)
+	}
+}
@@ -1,41 +1,126 @@
 package sign
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 )
 
-// LoadPrivateKeyFromFile loads a EC private key from file
-func LoadPrivateKeyFromFile(filePath string) (*ecdsa.PrivateKey, error) {
-	pkBytes, err := os.ReadFile("./private.pem")
+// LoadPrivateKeyFromFile loads a PEM private key from file, see ParsePrivateKey
+func LoadPrivateKeyFromFile(filePath string) (crypto.PrivateKey, error) {
+	pkBytes, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("os read file: %w", err)
 	}
 
-	pemBlock, _ := pem.Decode(pkBytes)
-	privateKey, err := x509.ParseECPrivateKey(pemBlock.Bytes)
+	return ParsePrivateKey(pkBytes)
+}
+
+// LoadPrivateKey loads a base64 encoded PEM private key, see ParsePrivateKey
+func LoadPrivateKey(file string) (crypto.PrivateKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(file)
 	if err != nil {
-		return nil, fmt.Errorf("x509 parse private key: %w", err)
+		return nil, fmt.Errorf("base64 url decode: %w", err)
+	}
+
+	return ParsePrivateKey(decoded)
+}
+
+// ParsePrivateKey parses a PEM private key. The PEM type decides the format:
+// "EC PRIVATE KEY" (SEC 1), "RSA PRIVATE KEY" (PKCS#1) or "PRIVATE KEY"
+// (PKCS#8, holding an ECDSA, Ed25519 or RSA key).
+func ParsePrivateKey(pemBytes []byte) (crypto.PrivateKey, error) {
+	pemBlock, _ := pem.Decode(pemBytes)
+	if pemBlock == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch pemBlock.Type {
+	case "EC PRIVATE KEY":
+		privateKey, err := x509.ParseECPrivateKey(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509 parse ec private key: %w", err)
+		}
+		return privateKey, nil
+	case "RSA PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509 parse pkcs1 private key: %w", err)
+		}
+		return privateKey, nil
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509 parse pkcs8 private key: %w", err)
+		}
+		switch privateKey.(type) {
+		case *ecdsa.PrivateKey, ed25519.PrivateKey, *rsa.PrivateKey:
+			return privateKey, nil
+		default:
+			return nil, fmt.Errorf("%T: %w", privateKey, ErrUnsupportedKey)
+		}
+	default:
+		return nil, fmt.Errorf("PEM type %q: %w", pemBlock.Type, ErrUnsupportedKey)
 	}
+}
 
-	return privateKey, nil
+// LoadSecretKey loads a base64 encoded HMAC secret
+func LoadSecretKey(file string) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(file))
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode: %w", err)
+	}
+	if len(secret) < minHMACKeySize {
+		return nil, fmt.Errorf("hmac secret of %d bytes, at least %d required: %w", len(secret), minHMACKeySize, ErrUnsupportedKey)
+	}
+	return secret, nil
 }
 
-func LoadPrivateKey(file string) (*ecdsa.PrivateKey, error) {
+// LoadPublicKey loads a base64 encoded PEM public key, see ParsePublicKey
+func LoadPublicKey(file string) (crypto.PublicKey, error) {
 	decoded, err := base64.StdEncoding.DecodeString(file)
 	if err != nil {
 		return nil, fmt.Errorf("base64 url decode: %w", err)
 	}
 
-	pemBlock, _ := pem.Decode(decoded)
-	privateKey, err := x509.ParseECPrivateKey(pemBlock.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("x509 parse private key: %w", err)
+	return ParsePublicKey(decoded)
+}
+
+// ParsePublicKey parses a PEM public key, either "PUBLIC KEY" (PKIX, as
+// produced by "openssl pkey -pubout") or "RSA PUBLIC KEY" (PKCS#1)
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	pemBlock, _ := pem.Decode(pemBytes)
+	if pemBlock == nil {
+		return nil, errors.New("no PEM block found")
 	}
 
-	return privateKey, nil
+	switch pemBlock.Type {
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509 parse public key: %w", err)
+		}
+		switch publicKey.(type) {
+		case *ecdsa.PublicKey, ed25519.PublicKey, *rsa.PublicKey:
+			return publicKey, nil
+		default:
+			return nil, fmt.Errorf("%T: %w", publicKey, ErrUnsupportedKey)
+		}
+	case "RSA PUBLIC KEY":
+		publicKey, err := x509.ParsePKCS1PublicKey(pemBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509 parse pkcs1 public key: %w", err)
+		}
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("PEM type %q: %w", pemBlock.Type, ErrUnsupportedKey)
+	}
 }
@@ -8,3 +8,11 @@ type Encoder interface {
 	Encode([]byte) string
 	Decode(string) ([]byte, error)
 }
+
+type Signer interface {
+	Sign(message string) (string, error)
+}
+
+type Verifier interface {
+	Verify(signature, message string) (bool, error)
+}
@@ -0,0 +1,76 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing
+const minRSABits = 2048
+
+var pssOptions = &rsa.PSSOptions{
+	SaltLength: rsa.PSSSaltLengthEqualsHash,
+	Hash:       crypto.SHA256,
+}
+
+type rsaPSSSigner struct {
+	privateKey *rsa.PrivateKey
+	encoder    Encoder
+}
+
+// NewRSAPSS is a constructor function for the rsaPSSSigner type. It signs the
+// SHA-256 hash of the message with RSASSA-PSS.
+func NewRSAPSS(privKey *rsa.PrivateKey, encoder Encoder) (*rsaPSSSigner, error) {
+	if privKey.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("rsa key of %d bits, at least %d required: %w", privKey.N.BitLen(), minRSABits, ErrUnsupportedKey)
+	}
+	return &rsaPSSSigner{
+		privateKey: privKey,
+		encoder:    encoder,
+	}, nil
+}
+
+// Sign generates a digital signature based on the provided message
+func (r *rsaPSSSigner) Sign(message string) (string, error) {
+	hash := sha256.Sum256([]byte(message))
+	signatureBytes, err := rsa.SignPSS(rand.Reader, r.privateKey, crypto.SHA256, hash[:], pssOptions)
+	if err != nil {
+		return "", fmt.Errorf("rsa pss sign: %w", err)
+	}
+	return r.encoder.Encode(signatureBytes), nil
+}
+
+type rsaPSSVerifier struct {
+	publicKey *rsa.PublicKey
+	encoder   Encoder
+}
+
+// NewRSAPSSVerifier is a constructor function for the rsaPSSVerifier type
+func NewRSAPSSVerifier(pubKey *rsa.PublicKey, encoder Encoder) *rsaPSSVerifier {
+	return &rsaPSSVerifier{
+		publicKey: pubKey,
+		encoder:   encoder,
+	}
+}
+
+// Verify checks the validity of the given signature
+func (r *rsaPSSVerifier) Verify(signature, message string) (bool, error) {
+	signatureBytes, err := r.encoder.Decode(signature)
+	if err != nil {
+		return false, fmt.Errorf("signature string decode: %w", err)
+	}
+
+	hash := sha256.Sum256([]byte(message))
+	err = rsa.VerifyPSS(r.publicKey, crypto.SHA256, hash[:], signatureBytes, pssOptions)
+	if errors.Is(err, rsa.ErrVerification) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("rsa pss verify: %w", err)
+	}
+	return true, nil
+}
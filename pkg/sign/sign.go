@@ -33,15 +33,7 @@ func (ec *ecdsaSigner) Sign(message string) (string, error) {
 	return signature, nil
 }
 
-// Verify checks the validity of the given signature
-func (ec *ecdsaSigner) Verify(signature, message string) (bool, error) {
-	signatureBytes, err := ec.encoder.Decode(signature)
-	if err != nil {
-		return false, fmt.Errorf("signature string decode: %w", err)
-	}
-
-	hash := ec.hasher.Hash([]byte(message))
-
-	valid := ecdsa.VerifyASN1(&ec.privateKey.PublicKey, hash, signatureBytes)
-	return valid, nil
+// PublicKey returns the public key that verifies the signatures of the signer
+func (ec *ecdsaSigner) PublicKey() *ecdsa.PublicKey {
+	return &ec.privateKey.PublicKey
 }
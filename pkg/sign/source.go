@@ -0,0 +1,130 @@
+package sign
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type staticSource struct {
+	keys []Key
+}
+
+// NewStaticSource is a constructor function for the staticSource type. It
+// serves a single key whose ID is the key's JWK thumbprint.
+func NewStaticSource(privateKey crypto.PrivateKey) (*staticSource, error) {
+	publicKey, err := PublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := KeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &staticSource{
+		keys: []Key{{ID: keyID, PrivateKey: privateKey}},
+	}, nil
+}
+
+// Keys returns the key of the source
+func (source *staticSource) Keys() ([]Key, error) {
+	return source.keys, nil
+}
+
+// activeFileName is the optional file of a key directory holding the ID of the key that signs
+const activeFileName = "active"
+
+type dirSource struct {
+	dir string
+
+	mu sync.Mutex
+	// listing identifies the directory state the cached keys were loaded from
+	listing string
+	keys    []Key
+}
+
+// NewDirSource is a constructor function for the dirSource type. Every "*.pem"
+// file in the directory holds a PEM private key and every "*.key" file a base64
+// encoded HMAC secret. The file name without the extension is the key ID and the
+// file modification time is when the key was added. The key named in the
+// optional "active" file signs, whatever the file times are.
+func NewDirSource(dir string) *dirSource {
+	return &dirSource{
+		dir: dir,
+	}
+}
+
+// Keys returns the keys in the directory, the files are read again only when
+// the directory changed
+func (source *dirSource) Keys() ([]Key, error) {
+	pemPaths, err := filepath.Glob(filepath.Join(source.dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("list key files: %w", err)
+	}
+	secretPaths, err := filepath.Glob(filepath.Join(source.dir, "*.key"))
+	if err != nil {
+		return nil, fmt.Errorf("list key files: %w", err)
+	}
+	paths := append(pemPaths, secretPaths...)
+
+	var listing strings.Builder
+	infos := make([]os.FileInfo, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("os stat: %w", err)
+		}
+		infos = append(infos, info)
+		fmt.Fprintf(&listing, "%s %d %d\n", info.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	activeID, err := os.ReadFile(filepath.Join(source.dir, activeFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("os read file: %w", err)
+	}
+	fmt.Fprintf(&listing, "%s %s\n", activeFileName, activeID)
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+
+	if source.keys != nil && listing.String() == source.listing {
+		return source.keys, nil
+	}
+
+	active := strings.TrimSpace(string(activeID))
+	keys := make([]Key, 0, len(paths))
+	for i, path := range paths {
+		pkBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("os read file: %w", err)
+		}
+		var privateKey crypto.PrivateKey
+		if filepath.Ext(path) == ".key" {
+			privateKey, err = LoadSecretKey(string(pkBytes))
+		} else {
+			privateKey, err = ParsePrivateKey(pkBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: %w", infos[i].Name(), err)
+		}
+		keyID := strings.TrimSuffix(infos[i].Name(), filepath.Ext(path))
+		keys = append(keys, Key{
+			ID:         keyID,
+			PrivateKey: privateKey,
+			Since:      infos[i].ModTime(),
+			Active:     keyID == active,
+		})
+	}
+	if active != "" && !slices.ContainsFunc(keys, func(key Key) bool { return key.Active }) {
+		return nil, fmt.Errorf("active key %q not found: %w", active, ErrInvalidKeyID)
+	}
+
+	source.listing = listing.String()
+	source.keys = keys
+	return keys, nil
+}
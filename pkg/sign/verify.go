@@ -0,0 +1,191 @@
+package sign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ecdsaVerifier struct {
+	publicKey *ecdsa.PublicKey
+	hasher    Hasher
+	encoder   Encoder
+}
+
+// NewECDSAVerifier is a constructor function for the ecdsaVerifier type. It
+// only needs the public key of the signer.
+func NewECDSAVerifier(pubKey *ecdsa.PublicKey, hasher Hasher, encoder Encoder) *ecdsaVerifier {
+	return &ecdsaVerifier{
+		publicKey: pubKey,
+		hasher:    hasher,
+		encoder:   encoder,
+	}
+}
+
+// Verify checks the validity of the given signature
+func (ec *ecdsaVerifier) Verify(signature, message string) (bool, error) {
+	signatureBytes, err := ec.encoder.Decode(signature)
+	if err != nil {
+		return false, fmt.Errorf("signature string decode: %w", err)
+	}
+
+	hash := ec.hasher.Hash([]byte(message))
+
+	valid := ecdsa.VerifyASN1(ec.publicKey, hash, signatureBytes)
+	return valid, nil
+}
+
+// KeySet returns the public key of the verifier as a JSON Web Key Set
+func (ec *ecdsaVerifier) KeySet() (JSONWebKeySet, error) {
+	key, err := NewJSONWebKey(ec.publicKey)
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+	return JSONWebKeySet{Keys: []JSONWebKey{key}}, nil
+}
+
+type keySetVerifier struct {
+	// verifiers maps a key ID to the verifier of that key
+	verifiers map[string]Verifier
+	keySet    JSONWebKeySet
+}
+
+// NewKeySetVerifier is a constructor function for the keySetVerifier type. The
+// set may mix ECDSA, Ed25519 and RSA keys. A
+// signature carrying a key ID is checked with that key only, other signatures
+// are valid if any key of the set verifies them.
+func NewKeySetVerifier(keySet JSONWebKeySet, hasher Hasher, encoder Encoder) (*keySetVerifier, error) {
+	verifiers := make(map[string]Verifier, len(keySet.Keys))
+	for _, key := range keySet.Keys {
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.KeyID, err)
+		}
+		verifier, err := NewVerifier(publicKey, hasher, encoder)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.KeyID, err)
+		}
+		verifiers[key.KeyID] = verifier
+	}
+	if len(verifiers) == 0 {
+		return nil, ErrEmptyKeySet
+	}
+
+	return &keySetVerifier{
+		verifiers: verifiers,
+		keySet:    keySet,
+	}, nil
+}
+
+// Verify checks the validity of the given signature against the key it names
+// or, without a key ID, against every key of the set
+func (ks *keySetVerifier) Verify(signature, message string) (bool, error) {
+	keyID, signature := splitKeyID(signature)
+	if keyID != "" {
+		verifier, ok := ks.verifiers[keyID]
+		if !ok {
+			return false, nil
+		}
+		return verifier.Verify(signature, message)
+	}
+
+	for _, verifier := range ks.verifiers {
+		valid, err := verifier.Verify(signature, message)
+		if err != nil {
+			return false, err
+		}
+		if valid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// KeySet returns the key set the verifier was created with
+func (ks *keySetVerifier) KeySet() (JSONWebKeySet, error) {
+	return ks.keySet, nil
+}
+
+type remoteKeySetVerifier struct {
+	client  *http.Client
+	url     string
+	hasher  Hasher
+	encoder Encoder
+
+	mu       sync.RWMutex
+	verifier *keySetVerifier
+}
+
+// NewRemoteKeySetVerifier is a constructor function for the remoteKeySetVerifier
+// type. It verifies signatures with the JSON Web Key Set published at url, e.g.
+// the /.well-known/jwks.json endpoint of the server that issues the tokens.
+func NewRemoteKeySetVerifier(client *http.Client, url string, hasher Hasher, encoder Encoder) (*remoteKeySetVerifier, error) {
+	remote := &remoteKeySetVerifier{
+		client:  client,
+		url:     url,
+		hasher:  hasher,
+		encoder: encoder,
+	}
+	if err := remote.Reload(); err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// Reload downloads the key set again. The verifier keeps its current keys if
+// the download fails.
+func (remote *remoteKeySetVerifier) Reload() error {
+	keySet, err := FetchJSONWebKeySet(context.Background(), remote.client, remote.url)
+	if err != nil {
+		return err
+	}
+	verifier, err := NewKeySetVerifier(keySet, remote.hasher, remote.encoder)
+	if err != nil {
+		return err
+	}
+
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+
+	remote.verifier = verifier
+	return nil
+}
+
+// Watch reloads the key set every interval until the context is done. Errors
+// are passed to onError and the current keys are kept.
+func (remote *remoteKeySetVerifier) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := remote.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Verify checks the validity of the given signature with the downloaded key set
+func (remote *remoteKeySetVerifier) Verify(signature, message string) (bool, error) {
+	remote.mu.RLock()
+	verifier := remote.verifier
+	remote.mu.RUnlock()
+
+	return verifier.Verify(signature, message)
+}
+
+// KeySet returns the downloaded key set
+func (remote *remoteKeySetVerifier) KeySet() (JSONWebKeySet, error) {
+	remote.mu.RLock()
+	verifier := remote.verifier
+	remote.mu.RUnlock()
+
+	return verifier.KeySet()
+}
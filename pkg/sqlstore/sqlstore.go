@@ -0,0 +1,540 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+)
+
+const (
+	maxMessages       = 100
+	maxPublishRetries = 5
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS chat_rooms (
+		name VARCHAR(64) PRIMARY KEY
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_messages (
+		room    VARCHAR(64) NOT NULL,
+		seq     BIGINT      NOT NULL,
+		message TEXT        NOT NULL,
+		PRIMARY KEY (room, seq)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_grants (
+		room        VARCHAR(64)  NOT NULL,
+		client_id   VARCHAR(255) NOT NULL,
+		permissions TEXT         NOT NULL,
+		PRIMARY KEY (room, client_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_published (
+		room       VARCHAR(64)  NOT NULL,
+		dedup_key  VARCHAR(255) NOT NULL,
+		seq        BIGINT       NOT NULL,
+		expires_at BIGINT       NOT NULL,
+		PRIMARY KEY (room, dedup_key)
+	)`,
+}
+
+type sqlStore struct {
+	db *sql.DB
+	// placeholders holds the bind parameter style of the driver - "?" or "$"
+	placeholders string
+	// lockRoom serializes the publishes to a room until the transaction ends, it is
+	// empty for sqlite which allows a single writer anyway
+	lockRoom     string
+	pollInterval time.Duration
+
+	mu sync.Mutex
+	// updated holds a channel per room that is closed and replaced whenever
+	// this instance publishes to the room, so local readers don't wait for the next poll
+	updated map[string]chan struct{}
+}
+
+// New is a constructor function for the sqlStore type. The driver must be
+// registered with database/sql, "sqlite" and "pgx" are supported. New messages
+// published by other instances are picked up every pollInterval.
+func New(driver, dsn string, pollInterval time.Duration) (*sqlStore, error) {
+	placeholders := "?"
+	lockRoom := ""
+	if driver == "pgx" || driver == "postgres" {
+		placeholders = "$"
+		lockRoom = "SELECT pg_advisory_xact_lock(hashtext($1))"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql open: %w", err)
+	}
+	if driver == "sqlite" {
+		// sqlite allows a single writer, serialize access instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("sql ping: %w", err)
+	}
+
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("sql create schema: %w", err)
+		}
+	}
+
+	return &sqlStore{
+		db:           db,
+		placeholders: placeholders,
+		lockRoom:     lockRoom,
+		pollInterval: pollInterval,
+		updated:      make(map[string]chan struct{}),
+	}, nil
+}
+
+// PublishMessage saves a message in the database. The returned value is the
+// message cursor - the requested sortKey unless another message already took
+// it, in which case the next free cursor is used.
+func (store *sqlStore) PublishMessage(room string, sortKey float64, message any) (int64, error) {
+	cursor, _, err := store.publish(room, "", 0, sortKey, message)
+	return cursor, err
+}
+
+// PublishUniqueMessage saves a message unless a message with the same key was
+// published to the room within the window. It returns the cursor of the stored
+// message and true when the message is a duplicate and was not saved again.
+func (store *sqlStore) PublishUniqueMessage(room, key string, window time.Duration, sortKey float64, message any) (int64, bool, error) {
+	return store.publish(room, key, window, sortKey, message)
+}
+
+func (store *sqlStore) publish(room, key string, window time.Duration, sortKey float64, message any) (int64, bool, error) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return 0, false, fmt.Errorf("json marshal: %w", err)
+	}
+
+	var cursor int64
+	var duplicate bool
+	err = retryUniqueViolation(maxPublishRetries, func() error {
+		var err error
+		cursor, duplicate, err = store.insertMessage(room, key, window, int64(sortKey), string(messageBytes))
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("sql insert message: %w", err)
+	}
+
+	if !duplicate {
+		store.notify(room)
+	}
+
+	return cursor, duplicate, nil
+}
+
+// insertMessage stores the message in a transaction. With a deduplication key
+// the message is only stored when the key was not used within the window. The
+// publishes to a room are serialized, so that the messages are committed in
+// cursor order and a poller never skips a message committed late.
+func (store *sqlStore) insertMessage(room, key string, window time.Duration, sortKey int64, message string) (int64, bool, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if store.lockRoom != "" {
+		if _, err := tx.Exec(store.lockRoom, room); err != nil {
+			return 0, false, fmt.Errorf("lock room: %w", err)
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	if key != "" {
+		_, err = tx.Exec(
+			store.bind("DELETE FROM chat_published WHERE room = ? AND expires_at <= ?"),
+			room, now,
+		)
+		if err != nil {
+			return 0, false, fmt.Errorf("delete expired keys: %w", err)
+		}
+		var published int64
+		err = tx.QueryRow(
+			store.bind("SELECT seq FROM chat_published WHERE room = ? AND dedup_key = ?"),
+			room, key,
+		).Scan(&published)
+		if err == nil {
+			return published, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, false, fmt.Errorf("select published key: %w", err)
+		}
+	}
+
+	var last sql.NullInt64
+	err = tx.QueryRow(
+		store.bind("SELECT MAX(seq) FROM chat_messages WHERE room = ?"),
+		room,
+	).Scan(&last)
+	if err != nil {
+		return 0, false, fmt.Errorf("select last cursor: %w", err)
+	}
+
+	cursor := sortKey
+	if last.Valid && last.Int64 >= cursor {
+		cursor = last.Int64 + 1
+	}
+
+	_, err = tx.Exec(
+		store.bind("INSERT INTO chat_messages (room, seq, message) VALUES (?, ?, ?)"),
+		room, cursor, message,
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("insert: %w", err)
+	}
+
+	if key != "" {
+		_, err = tx.Exec(
+			store.bind("INSERT INTO chat_published (room, dedup_key, seq, expires_at) VALUES (?, ?, ?, ?)"),
+			room, key, cursor, now+window.Milliseconds(),
+		)
+		if err != nil {
+			return 0, false, fmt.Errorf("insert published key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return cursor, false, nil
+}
+
+// ReadMessages sends all messages stored in the room after the since cursor and
+// then every new message, either as soon as this instance publishes it or after
+// the next poll
+func (store *sqlStore) ReadMessages(ctx context.Context, room string, since int64) (<-chan model.StoredMessage, <-chan error) {
+	msgsChan := make(chan model.StoredMessage)
+	errorsChan := make(chan error)
+
+	go func() {
+		defer close(msgsChan)
+		defer close(errorsChan)
+
+		for {
+			// take the channel before reading so a publish in between is not missed
+			updated := store.updates(room)
+
+			messages, err := store.ReadRange(room, since, 0, maxMessages, false)
+			if err != nil {
+				select {
+				case errorsChan <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+			for _, msg := range messages {
+				select {
+				case msgsChan <- msg:
+					since = msg.Cursor
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(messages) == maxMessages {
+				continue
+			}
+
+			select {
+			case <-updated:
+			case <-time.After(store.pollInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return msgsChan, errorsChan
+}
+
+// ReadRange reads up to limit messages with cursors between after and before
+// (both exclusive, 0 means unbounded) in ascending cursor order. When newest is
+// set the messages closest to before are returned, otherwise the ones closest
+// to after. A limit of 0 or less returns no messages.
+func (store *sqlStore) ReadRange(room string, after, before int64, limit int64, newest bool) ([]model.StoredMessage, error) {
+	if limit <= 0 {
+		return []model.StoredMessage{}, nil
+	}
+
+	query := "SELECT seq, message FROM chat_messages WHERE room = ?"
+	args := []any{room}
+	if after > 0 {
+		query += " AND seq > ?"
+		args = append(args, after)
+	}
+	if before > 0 {
+		query += " AND seq < ?"
+		args = append(args, before)
+	}
+	if newest {
+		query += " ORDER BY seq DESC"
+	} else {
+		query += " ORDER BY seq ASC"
+	}
+	query += " LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := store.db.Query(store.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("sql select messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []model.StoredMessage{}
+	for rows.Next() {
+		msg := model.StoredMessage{}
+		if err := rows.Scan(&msg.Cursor, &msg.Message); err != nil {
+			return nil, fmt.Errorf("sql scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql read messages: %w", err)
+	}
+
+	if newest {
+		sort.Slice(messages, func(i, j int) bool {
+			return messages[i].Cursor < messages[j].Cursor
+		})
+	}
+
+	return messages, nil
+}
+
+// CreateRoom registers the room; it returns false if the room already exists
+func (store *sqlStore) CreateRoom(room string) (bool, error) {
+	exists, err := store.RoomExists(room)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	_, err = store.db.Exec(store.bind("INSERT INTO chat_rooms (name) VALUES (?)"), room)
+	if err != nil {
+		// lost a race with another instance creating the same room
+		if exists, existsErr := store.RoomExists(room); existsErr == nil && exists {
+			return false, nil
+		}
+		return false, fmt.Errorf("sql insert room: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteRoom removes the room together with its messages and grants; it returns false if the room does not exist
+func (store *sqlStore) DeleteRoom(room string) (bool, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("sql begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(store.bind("DELETE FROM chat_rooms WHERE name = ?"), room)
+	if err != nil {
+		return false, fmt.Errorf("sql delete room: %w", err)
+	}
+	if _, err := tx.Exec(store.bind("DELETE FROM chat_messages WHERE room = ?"), room); err != nil {
+		return false, fmt.Errorf("sql delete messages: %w", err)
+	}
+	if _, err := tx.Exec(store.bind("DELETE FROM chat_grants WHERE room = ?"), room); err != nil {
+		return false, fmt.Errorf("sql delete grants: %w", err)
+	}
+	if _, err := tx.Exec(store.bind("DELETE FROM chat_published WHERE room = ?"), room); err != nil {
+		return false, fmt.Errorf("sql delete published keys: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("sql commit transaction: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("sql rows affected: %w", err)
+	}
+	return deleted == 1, nil
+}
+
+// ListRooms returns the names of all registered rooms in alphabetical order
+func (store *sqlStore) ListRooms() ([]string, error) {
+	rows, err := store.db.Query("SELECT name FROM chat_rooms ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("sql select rooms: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []string{}
+	for rows.Next() {
+		var room string
+		if err := rows.Scan(&room); err != nil {
+			return nil, fmt.Errorf("sql scan room: %w", err)
+		}
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql read rooms: %w", err)
+	}
+	return rooms, nil
+}
+
+// RoomExists checks whether the room is registered
+func (store *sqlStore) RoomExists(room string) (bool, error) {
+	var name string
+	err := store.db.QueryRow(store.bind("SELECT name FROM chat_rooms WHERE name = ?"), room).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("sql select room: %w", err)
+	}
+	return true, nil
+}
+
+// Grants returns the grants of the room
+func (store *sqlStore) Grants(room string) ([]model.Grant, error) {
+	rows, err := store.db.Query(store.bind("SELECT client_id, permissions FROM chat_grants WHERE room = ?"), room)
+	if err != nil {
+		return nil, fmt.Errorf("sql select grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []model.Grant{}
+	for rows.Next() {
+		var clientID, permissions string
+		if err := rows.Scan(&clientID, &permissions); err != nil {
+			return nil, fmt.Errorf("sql scan grant: %w", err)
+		}
+		grants = append(grants, model.Grant{
+			ClientID:    clientID,
+			Permissions: strings.Fields(permissions),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sql read grants: %w", err)
+	}
+	return grants, nil
+}
+
+// SetGrant replaces the permissions of the grant's client in the room
+func (store *sqlStore) SetGrant(room string, grant model.Grant) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(store.bind("DELETE FROM chat_grants WHERE room = ? AND client_id = ?"), room, grant.ClientID)
+	if err != nil {
+		return fmt.Errorf("sql delete grant: %w", err)
+	}
+	_, err = tx.Exec(
+		store.bind("INSERT INTO chat_grants (room, client_id, permissions) VALUES (?, ?, ?)"),
+		room, grant.ClientID, strings.Join(grant.Permissions, " "),
+	)
+	if err != nil {
+		return fmt.Errorf("sql insert grant: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteGrant removes the client's grant in the room; it returns false if there is none
+func (store *sqlStore) DeleteGrant(room, clientID string) (bool, error) {
+	result, err := store.db.Exec(store.bind("DELETE FROM chat_grants WHERE room = ? AND client_id = ?"), room, clientID)
+	if err != nil {
+		return false, fmt.Errorf("sql delete grant: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("sql rows affected: %w", err)
+	}
+	return deleted == 1, nil
+}
+
+// updates returns the channel that is closed on the next local publish to the room
+func (store *sqlStore) updates(room string) chan struct{} {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	updated, ok := store.updated[room]
+	if !ok {
+		updated = make(chan struct{})
+		store.updated[room] = updated
+	}
+	return updated
+}
+
+// notify wakes up the local readers of the room
+func (store *sqlStore) notify(room string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if updated, ok := store.updated[room]; ok {
+		close(updated)
+		delete(store.updated, room)
+	}
+}
+
+// bind rewrites the "?" placeholders of the query to the driver's style
+func (store *sqlStore) bind(query string) string {
+	if store.placeholders == "?" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// retryUniqueViolation calls insert until it succeeds, fails with another error
+// or was called attempts times. Only a concurrent publish that took the same
+// cursor or deduplication key is retried.
+func retryUniqueViolation(attempts int, insert func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = insert()
+		if err == nil || !isUniqueViolation(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isUniqueViolation reports whether the error is a primary key or unique
+// constraint violation of the postgres or sqlite driver
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		// SQLITE_CONSTRAINT_PRIMARYKEY and SQLITE_CONSTRAINT_UNIQUE
+		return sqliteErr.Code() == 1555 || sqliteErr.Code() == 2067
+	}
+	return false
+}
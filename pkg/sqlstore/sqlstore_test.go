@@ -0,0 +1,224 @@
+package sqlstore
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgdraganov/crispy-chat-service/internal/model"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) *sqlStore {
+	t.Helper()
+
+	store, err := New("sqlite", filepath.Join(t.TempDir(), "chat.db"), time.Second)
+	if err != nil {
+		t.Fatalf("new sql store: %v", err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+	return store
+}
+
+func TestConcurrentPublishesBumpCursor(t *testing.T) {
+	store := newTestStore(t)
+
+	const publishes = 20
+	cursors := make([]int64, publishes)
+	var wg sync.WaitGroup
+	for i := range cursors {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// every message asks for the same cursor
+			cursor, err := store.PublishMessage("room", 1, "hello")
+			if err != nil {
+				t.Errorf("publish message: %v", err)
+			}
+			cursors[i] = cursor
+		}(i)
+	}
+	wg.Wait()
+
+	slices.Sort(cursors)
+	for i, cursor := range cursors {
+		if cursor != int64(i+1) {
+			t.Fatalf("got cursors %v, want 1 to %d", cursors, publishes)
+		}
+	}
+}
+
+func TestRetryUniqueViolation(t *testing.T) {
+	store := newTestStore(t)
+	if _, err := store.PublishMessage("room", 1, "hello"); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+	_, violation := store.db.Exec("INSERT INTO chat_messages (room, seq, message) VALUES ('room', 1, 'taken')")
+	if !isUniqueViolation(violation) {
+		t.Fatalf("got error %v, want a unique violation", violation)
+	}
+	_, otherErr := store.db.Exec("INSERT INTO chat_messages (room, seq) VALUES ('room', 2)")
+	if otherErr == nil || isUniqueViolation(otherErr) {
+		t.Fatalf("got error %v, want a not null violation", otherErr)
+	}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "no error", errs: []error{nil}, wantCalls: 1},
+		{name: "cursor taken once", errs: []error{violation, nil}, wantCalls: 2},
+		{name: "other error", errs: []error{otherErr, nil}, wantCalls: 1, wantErr: otherErr},
+		{name: "cursor always taken", errs: []error{violation, violation, violation}, wantCalls: 3, wantErr: violation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryUniqueViolation(3, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPublishUniqueMessageWindow(t *testing.T) {
+	store := newTestStore(t)
+	window := 50 * time.Millisecond
+
+	cursor, duplicate, err := store.PublishUniqueMessage("room", "Jim:1", window, 1, "hello")
+	if err != nil || duplicate || cursor != 1 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want cursor 1", cursor, duplicate, err)
+	}
+	cursor, duplicate, err = store.PublishUniqueMessage("room", "Jim:1", window, 2, "hello")
+	if err != nil || !duplicate || cursor != 1 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want duplicate of cursor 1", cursor, duplicate, err)
+	}
+	// the key is per room
+	cursor, duplicate, err = store.PublishUniqueMessage("other", "Jim:1", window, 2, "hello")
+	if err != nil || duplicate || cursor != 2 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want cursor 2 in the other room", cursor, duplicate, err)
+	}
+
+	time.Sleep(2 * window)
+	cursor, duplicate, err = store.PublishUniqueMessage("room", "Jim:1", window, 3, "hello")
+	if err != nil || duplicate || cursor != 3 {
+		t.Fatalf("got cursor %d, duplicate %t, error %v, want cursor 3 after the window", cursor, duplicate, err)
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	store := newTestStore(t)
+	for sortKey := 1; sortKey <= 5; sortKey++ {
+		if _, err := store.PublishMessage("room", float64(sortKey), sortKey); err != nil {
+			t.Fatalf("publish message: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		after, before int64
+		limit         int64
+		newest        bool
+		want          []int64
+	}{
+		{name: "first page", limit: 2, want: []int64{1, 2}},
+		{name: "next page", after: 2, limit: 2, want: []int64{3, 4}},
+		{name: "last page", after: 4, limit: 2, want: []int64{5}},
+		{name: "newest page", limit: 2, newest: true, want: []int64{4, 5}},
+		{name: "previous page", before: 4, limit: 2, newest: true, want: []int64{2, 3}},
+		{name: "between cursors", after: 1, before: 5, limit: 10, want: []int64{2, 3, 4}},
+		{name: "zero limit", limit: 0, want: []int64{}},
+		{name: "negative limit", limit: -1, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := store.ReadRange("room", tt.after, tt.before, tt.limit, tt.newest)
+			if err != nil {
+				t.Fatalf("read range: %v", err)
+			}
+			got := []int64{}
+			for _, msg := range page {
+				got = append(got, msg.Cursor)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got cursors %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoomsAndGrants(t *testing.T) {
+	store := newTestStore(t)
+
+	for _, room := range []string{"b", "a"} {
+		created, err := store.CreateRoom(room)
+		if err != nil || !created {
+			t.Fatalf("create room %s: created %t, error %v", room, created, err)
+		}
+	}
+	if created, err := store.CreateRoom("a"); err != nil || created {
+		t.Fatalf("create existing room: created %t, error %v", created, err)
+	}
+	rooms, err := store.ListRooms()
+	if err != nil || !slices.Equal(rooms, []string{"a", "b"}) {
+		t.Fatalf("got rooms %v, error %v, want [a b]", rooms, err)
+	}
+
+	if err := store.SetGrant("a", model.Grant{ClientID: "Jim", Permissions: []string{"room:read"}}); err != nil {
+		t.Fatalf("set grant: %v", err)
+	}
+	if err := store.SetGrant("a", model.Grant{ClientID: "Jim", Permissions: []string{"room:read", "room:write"}}); err != nil {
+		t.Fatalf("replace grant: %v", err)
+	}
+	grants, err := store.Grants("a")
+	if err != nil || len(grants) != 1 || !slices.Equal(grants[0].Permissions, []string{"room:read", "room:write"}) {
+		t.Fatalf("got grants %+v, error %v, want Jim's replaced grant", grants, err)
+	}
+	if deleted, err := store.DeleteGrant("a", "Jim"); err != nil || !deleted {
+		t.Fatalf("delete grant: deleted %t, error %v", deleted, err)
+	}
+	if deleted, err := store.DeleteGrant("a", "Jim"); err != nil || deleted {
+		t.Fatalf("delete missing grant: deleted %t, error %v", deleted, err)
+	}
+
+	// deleting a room removes its messages, grants and deduplication keys
+	if err := store.SetGrant("b", model.Grant{ClientID: "Jim", Permissions: []string{"room:read"}}); err != nil {
+		t.Fatalf("set grant: %v", err)
+	}
+	if _, _, err := store.PublishUniqueMessage("b", "Jim:1", time.Minute, 1, "hello"); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+	if deleted, err := store.DeleteRoom("b"); err != nil || !deleted {
+		t.Fatalf("delete room: deleted %t, error %v", deleted, err)
+	}
+	if exists, err := store.RoomExists("b"); err != nil || exists {
+		t.Fatalf("deleted room exists %t, error %v", exists, err)
+	}
+	if page, err := store.ReadRange("b", 0, 0, 10, false); err != nil || len(page) != 0 {
+		t.Fatalf("got messages %v, error %v of the deleted room", page, err)
+	}
+	if grants, err := store.Grants("b"); err != nil || len(grants) != 0 {
+		t.Fatalf("got grants %v, error %v of the deleted room", grants, err)
+	}
+	if _, duplicate, err := store.PublishUniqueMessage("b", "Jim:1", time.Minute, 1, "hello"); err != nil || duplicate {
+		t.Fatalf("deduplication key of the deleted room kept: duplicate %t, error %v", duplicate, err)
+	}
+	if deleted, err := store.DeleteRoom("b"); err != nil || deleted {
+		t.Fatalf("delete missing room: deleted %t, error %v", deleted, err)
+	}
+}